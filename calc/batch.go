@@ -0,0 +1,283 @@
+package calc
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// A Batch stages changes to a table so that they can be checked together
+// and then made all at once, or not at all. This allows loading many
+// definitions without leaving the table with only some of them if others
+// are invalid.
+//
+// A batch is not safe for concurrent use, but its table may be used
+// concurrently while changes are being staged, since the table isn't
+// changed until Commit is called.
+type Batch struct {
+	t   *Table
+	ops []batchOp
+}
+
+// batchOp is a single staged change to either a symbol or a function.
+type batchOp struct {
+	name   string
+	remove bool
+	expr   Expression
+	isFunc bool
+	def    *funcDef
+}
+
+// Batch returns a new, empty batch of changes to the table.
+func (t *Table) Batch() *Batch {
+	return &Batch{t: t}
+}
+
+// Define stages a definition of the symbol with the given name, as with
+// Table.Define.
+func (b *Batch) Define(name string, expr Expression) hcl.Diagnostics {
+	if b.t.ReadOnly(name) {
+		return readOnlyDiags(name)
+	}
+	b.ops = append(b.ops, batchOp{
+		name: name,
+		expr: withVars(expr),
+	})
+	return nil
+}
+
+// Remove stages the removal of the symbol with the given name, as with
+// Table.Remove.
+func (b *Batch) Remove(name string) hcl.Diagnostics {
+	if b.t.ReadOnly(name) {
+		return readOnlyDiags(name)
+	}
+	b.ops = append(b.ops, batchOp{
+		name:   name,
+		remove: true,
+	})
+	return nil
+}
+
+// DefineFunc stages a definition of the function with the given name, as
+// with Table.DefineFunc.
+func (b *Batch) DefineFunc(name string, params []string, varParam bool, expr Expression) hcl.Diagnostics {
+	if ReservedFunc(name) {
+		return reservedFuncDiags(name)
+	}
+	b.ops = append(b.ops, batchOp{
+		name:   name,
+		isFunc: true,
+		def: &funcDef{
+			params:   params,
+			varParam: varParam,
+			expr:     withVars(expr),
+		},
+	})
+	return nil
+}
+
+// RemoveFunc stages the removal of the function with the given name, as
+// with Table.RemoveFunc.
+func (b *Batch) RemoveFunc(name string) {
+	b.ops = append(b.ops, batchOp{
+		name:   name,
+		remove: true,
+		isFunc: true,
+	})
+}
+
+// Len returns the number of changes staged in the batch.
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Source returns the source code of the symbol with the given name as it
+// is once the batch is committed.
+func (b *Batch) Source(name string) []byte {
+	for i := len(b.ops) - 1; i >= 0; i-- {
+		op := b.ops[i]
+		if op.name != name || op.isFunc {
+			continue
+		}
+		if op.remove {
+			return nil
+		}
+		return op.expr.Source
+	}
+	return b.t.Source(name)
+}
+
+// Commit makes all of the staged changes to the table, as long as the
+// table will be valid once they're made. If the changes would define
+// symbols or functions that refer to undefined symbols or remove symbols
+// that other symbols still refer to, then the table is left unchanged and
+// the returned diagnostics explain why.
+//
+// Changes that create dependency cycles are handled as Define handles
+// them: they are made with a warning, unless the table refuses cycles, in
+// which case they are errors and the table is left unchanged.
+//
+// A batch must not be changed or committed again once it has been
+// committed, whether or not that succeeded.
+func (b *Batch) Commit() hcl.Diagnostics {
+	t := b.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	undo := b.apply()
+	diags := b.validate()
+	if diags.HasErrors() {
+		undo()
+	}
+	return diags
+}
+
+// apply makes the staged changes to the table, returning a function that
+// reverts them. The caller must hold the table's write lock.
+func (b *Batch) apply() func() {
+	t := b.t
+	var undos []func()
+	for _, op := range b.ops {
+		name := op.name
+		if op.isFunc {
+			if prev, defined := t.funcDefs[name]; defined {
+				undos = append(undos, func() { t.defineFunc(name, prev) })
+			} else {
+				undos = append(undos, func() { t.removeFunc(name) })
+			}
+			if op.remove {
+				t.removeFunc(name)
+			} else {
+				t.defineFunc(name, op.def)
+			}
+			continue
+		}
+
+		if prev, defined := t.syms[name]; defined {
+			undos = append(undos, func() { t.define(name, prev) })
+		} else {
+			undos = append(undos, func() { t.remove(name) })
+		}
+		if op.remove {
+			t.remove(name)
+		} else {
+			t.define(name, op.expr)
+		}
+	}
+
+	return func() {
+		for i := len(undos) - 1; i >= 0; i-- {
+			undos[i]()
+		}
+	}
+}
+
+// validate checks the table once the staged changes have been applied to
+// it. The caller must hold the table's write lock.
+func (b *Batch) validate() hcl.Diagnostics {
+	t := b.t
+	var diags hcl.Diagnostics
+
+	defined := newSymbolSet()
+	removed := newSymbolSet()
+	definedFuncs := newSymbolSet()
+	for _, op := range b.ops {
+		if op.isFunc {
+			if _, isDefined := t.funcDefs[op.name]; isDefined {
+				definedFuncs.Add(op.name)
+			} else {
+				definedFuncs.Remove(op.name)
+			}
+			continue
+		}
+		if t.readOnly.Has(op.name) {
+			diags = append(diags, readOnlyDiags(op.name)...)
+		}
+		if _, isDefined := t.syms[op.name]; isDefined {
+			defined.Add(op.name)
+			removed.Remove(op.name)
+		} else {
+			removed.Add(op.name)
+			defined.Remove(op.name)
+		}
+	}
+
+	for _, name := range defined.AppendNames(nil) {
+		for _, traversal := range t.syms[name].Variables() {
+			reqdName := traversal.RootName()
+			if _, isDefined := t.syms[reqdName]; isDefined {
+				continue
+			}
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Variable not defined",
+				Detail:   fmt.Sprintf("The expression for %q refers to %q, which is not defined.%s", name, reqdName, t.symbolSuggestions(reqdName, nil)),
+				Subject:  traversal.SourceRange().Ptr(),
+			})
+		}
+	}
+
+	// Function bodies can refer to the table's symbols as well as to their
+	// parameters, so they must not refer to undefined symbols either.
+	for _, name := range definedFuncs.AppendNames(nil) {
+		def := t.funcDefs[name]
+		params := make(map[string]cty.Value, len(def.params))
+		for _, param := range def.params {
+			params[param] = cty.DynamicVal
+		}
+		for _, traversal := range def.expr.Variables() {
+			reqdName := traversal.RootName()
+			_, isDefined := t.syms[reqdName]
+			_, isParam := params[reqdName]
+			if isDefined || isParam {
+				continue
+			}
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Variable not defined",
+				Detail:   fmt.Sprintf("The expression for function %q refers to %q, which is neither defined nor one of its parameters.%s", name, reqdName, t.symbolSuggestions(reqdName, params)),
+				Subject:  traversal.SourceRange().Ptr(),
+			})
+		}
+	}
+
+	for _, name := range removed.AppendNames(nil) {
+		for _, dependent := range t.reqdBy.AllFrom(name).AppendNames(nil) {
+			if defined.Has(dependent) {
+				// Already reported above.
+				continue
+			}
+			for _, traversal := range t.syms[dependent].Variables() {
+				if traversal.RootName() != name {
+					continue
+				}
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Variable still in use",
+					Detail:   fmt.Sprintf("Cannot remove %q, because the expression for %q refers to it.", name, dependent),
+					Subject:  traversal.SourceRange().Ptr(),
+				})
+			}
+		}
+	}
+
+	// Cycles are errors only if the table refuses them, as with Define.
+	severity := hcl.DiagWarning
+	if t.refuseCycles {
+		severity = hcl.DiagError
+	}
+	for _, cycle := range t.findCycles(defined) {
+		// A cycle that includes none of the symbols defined by the batch
+		// was already present before it, so isn't reported.
+		for _, name := range cycle {
+			if defined.Has(name) {
+				diags = append(diags, t.cycleDiags(t.cyclePath(name), severity)...)
+				break
+			}
+		}
+	}
+
+	return diags
+}
@@ -0,0 +1,110 @@
+package calc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl2/hcl"
+)
+
+// testBatch defines a = 1 and b = a + 1 in a new table with the given
+// options and returns a batch of changes to it.
+func testBatch(t *testing.T, opts ...Option) (*Table, *Batch) {
+	table := NewTable(opts...)
+	if diags := table.Define("a", mustParse(t, "1")); diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	if diags := table.Define("b", mustParse(t, "a + 1")); diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	return table, table.Batch()
+}
+
+// checkRolledBack checks that committing a batch failed with the given
+// summary and that the table still has the definitions from testBatch.
+func checkRolledBack(t *testing.T, table *Table, batch *Batch, summary string) {
+	t.Helper()
+	diags := batch.Commit()
+	if !diags.HasErrors() {
+		t.Fatal("commit succeeded")
+	}
+	if !strings.Contains(diags.Error(), summary) {
+		t.Errorf("wrong diagnostics: %s", diags.Error())
+	}
+
+	want := map[string]string{"a": "1", "b": "a + 1", "c": ""}
+	for name, src := range want {
+		if got := string(table.Source(name)); got != src {
+			t.Errorf("%s is %q after rolling back, want %q", name, got, src)
+		}
+	}
+}
+
+func TestBatchCommit(t *testing.T) {
+	table, batch := testBatch(t)
+	batch.Define("a", mustParse(t, "2"))
+	batch.Define("c", mustParse(t, "b * 2"))
+	if diags := batch.Commit(); diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	got, diags := table.Value("c")
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	if got.AsBigFloat().String() != "6" {
+		t.Errorf("c is %#v, want 6", got)
+	}
+}
+
+func TestBatchUndefined(t *testing.T) {
+	table, batch := testBatch(t)
+	batch.Define("a", mustParse(t, "2"))
+	batch.Define("c", mustParse(t, "nope + 1"))
+	checkRolledBack(t, table, batch, "Variable not defined")
+}
+
+func TestBatchFuncUndefined(t *testing.T) {
+	table, batch := testBatch(t)
+	batch.Define("c", mustParse(t, "f(1)"))
+	batch.DefineFunc("f", []string{"x"}, false, mustParse(t, "x + nope"))
+	checkRolledBack(t, table, batch, "Variable not defined")
+	if _, defined := table.funcDefs["f"]; defined {
+		t.Error("f is defined after rolling back")
+	}
+
+	// A function's parameters may shadow the table's symbols.
+	batch = table.Batch()
+	batch.DefineFunc("f", []string{"a"}, false, mustParse(t, "a + b"))
+	if diags := batch.Commit(); diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+}
+
+func TestBatchStillInUse(t *testing.T) {
+	table, batch := testBatch(t)
+	batch.Define("c", mustParse(t, "1"))
+	batch.Remove("a")
+	checkRolledBack(t, table, batch, "Variable still in use")
+}
+
+func TestBatchCycle(t *testing.T) {
+	table, batch := testBatch(t)
+	batch.Define("a", mustParse(t, "b + 1"))
+	diags := batch.Commit()
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	if len(diags) == 0 || diags[0].Severity != hcl.DiagWarning {
+		t.Errorf("no warning about the cycle")
+	}
+	if got := string(table.Source("a")); got != "b + 1" {
+		t.Errorf("a is %q, want \"b + 1\"", got)
+	}
+}
+
+func TestBatchCycleRefused(t *testing.T) {
+	table, batch := testBatch(t, WithRefuseCycles(true))
+	batch.Define("c", mustParse(t, "1"))
+	batch.Define("a", mustParse(t, "b + 1"))
+	checkRolledBack(t, table, batch, "Dependency cycle")
+}
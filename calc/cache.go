@@ -0,0 +1,253 @@
+package calc
+
+import (
+	"sync"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// valueCache remembers the value of each symbol from the last time it was
+// evaluated, so that evaluations only need to evaluate the symbols that
+// changed since then, and those that depend on them.
+//
+// A table shares its cache with the views its evaluations run against, and
+// since those hold a read lock on the table, the cache can't be
+// invalidated while they use it. Each snapshot has a cache of its own.
+type valueCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedValue
+	stats   CacheStats
+}
+
+type cachedValue struct {
+	val   cty.Value
+	diags hcl.Diagnostics
+}
+
+// CacheStats describes the effectiveness of a table's value cache.
+type CacheStats struct {
+	// Entries is the number of symbols whose values are currently cached.
+	Entries int
+
+	// Hits and Misses count the number of times a symbol's value was
+	// needed and was or was not found in the cache, respectively.
+	Hits   int
+	Misses int
+
+	// Invalidations counts the number of cached values that were discarded
+	// because of changes to the table.
+	Invalidations int
+}
+
+func newValueCache() *valueCache {
+	return &valueCache{
+		entries: make(map[string]cachedValue),
+	}
+}
+
+func (c *valueCache) get(name string) (cachedValue, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cv, exists := c.entries[name]
+	if exists {
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+	return cv, exists
+}
+
+func (c *valueCache) put(name string, val cty.Value, diags hcl.Diagnostics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[name] = cachedValue{
+		val:   val,
+		diags: diags,
+	}
+}
+
+func (c *valueCache) invalidate(names symbolSet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name := range names {
+		if _, exists := c.entries[name]; exists {
+			delete(c.entries, name)
+			c.stats.Invalidations++
+		}
+	}
+}
+
+func (c *valueCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Invalidations += len(c.entries)
+	c.entries = make(map[string]cachedValue)
+}
+
+// CacheStats returns statistics about the table's value cache.
+func (t *Table) CacheStats() CacheStats {
+	t.cache.mu.Lock()
+	defer t.cache.mu.Unlock()
+	stats := t.cache.stats
+	stats.Entries = len(t.cache.entries)
+	return stats
+}
+
+// invalidateSymbol discards the cached values of the given symbol and of
+// everything that depends on it.
+func (t *Table) invalidateSymbol(name string) {
+	syms := newSymbolSet()
+	syms.Add(name)
+	t.invalidate(syms, newSymbolSet())
+}
+
+// invalidateFunc discards the cached values of everything that depends on
+// the user-defined function with the given name.
+func (t *Table) invalidateFunc(name string) {
+	funcs := newSymbolSet()
+	funcs.Add(name)
+	t.invalidate(newSymbolSet(), funcs)
+}
+
+// invalidate discards the cached values of the given symbols and of
+// everything that depends on them or on the given user-defined functions.
+// Symbols depend on the functions they call, and functions depend on the
+// other functions they call and on the symbols they refer to, since their
+// bodies can refer to the table's symbols as well as to their parameters.
+func (t *Table) invalidate(syms, funcs symbolSet) {
+	stale := newSymbolSet()
+	for name := range syms {
+		t.addDependents(name, stale)
+	}
+	doneFuncs := newSymbolSet()
+	for {
+		before := len(stale) + len(funcs)
+		for name, def := range t.funcDefs {
+			if !funcs.Has(name) && (callsAny(def.expr, funcs) || refersToAny(def.expr, stale)) {
+				funcs.Add(name)
+			}
+		}
+		for name := range funcs {
+			if doneFuncs.Has(name) {
+				continue
+			}
+			doneFuncs.Add(name)
+			for caller := range t.callers[name] {
+				t.addDependents(caller, stale)
+			}
+		}
+		if !funcs.Empty() {
+			// We can't tell which functions these call, so any change
+			// to a function might affect them.
+			for name := range t.opaque {
+				t.addDependents(name, stale)
+			}
+		}
+		if len(stale)+len(funcs) == before {
+			break
+		}
+	}
+	t.cache.invalidate(stale)
+}
+
+// addDependents adds the given symbol and all of the symbols that depend on
+// it, directly or indirectly, to the given set.
+func (t *Table) addDependents(name string, set symbolSet) {
+	if set.Has(name) {
+		return
+	}
+	set.Add(name)
+	stack := []string{name}
+	for len(stack) > 0 {
+		name, stack = stack[len(stack)-1], stack[:len(stack)-1]
+		for dependent := range t.reqdBy[name] {
+			if !set.Has(dependent) {
+				set.Add(dependent)
+				stack = append(stack, dependent)
+			}
+		}
+	}
+}
+
+// callsAny returns true if the given expression calls any of the functions
+// with the given names, or if its function calls are unknown.
+func callsAny(expr Expression, names symbolSet) bool {
+	if expr.calls == nil {
+		return true
+	}
+	for name := range expr.calls {
+		if names.Has(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func refersToAny(expr Expression, names symbolSet) bool {
+	for _, traversal := range expr.Variables() {
+		if names.Has(traversal.RootName()) {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheable returns true if the value of the given expression can be
+// cached. It can't be if the value may change without the table changing,
+// because the expression calls an impure function, or calls a function or
+// refers to a symbol that can't be cached, directly or indirectly.
+func (t *Table) cacheable(expr Expression) bool {
+	return !t.impureExpr(expr, newSymbolSet(), newSymbolSet())
+}
+
+// impureExpr implements cacheable. The given sets record the symbols and
+// user-defined functions already checked, since they may refer to each
+// other.
+func (t *Table) impureExpr(expr Expression, seenSyms, seenFuncs symbolSet) bool {
+	if expr.calls == nil {
+		return true
+	}
+	for name := range expr.calls {
+		def, exists := t.funcDefs[name]
+		switch {
+		case !exists && t.impure.Has(name):
+			return true
+		case exists && !seenFuncs.Has(name):
+			seenFuncs.Add(name)
+			if t.impureExpr(def.expr, seenSyms, seenFuncs) {
+				return true
+			}
+		}
+	}
+	for _, traversal := range expr.Variables() {
+		name := traversal.RootName()
+		symExpr, exists := t.syms[name]
+		if !exists || seenSyms.Has(name) {
+			continue
+		}
+		seenSyms.Add(name)
+		if t.impureSymbol(name, symExpr, seenSyms, seenFuncs) {
+			return true
+		}
+	}
+	return false
+}
+
+// impureSymbol is like impureExpr for the expression of the symbol with the
+// given name, remembering the result for the rest of the evaluation so
+// that the symbols shared by many others are only checked once.
+func (t *Table) impureSymbol(name string, expr Expression, seenSyms, seenFuncs symbolSet) bool {
+	t.purityMu.Lock()
+	impure, known := t.purity[name]
+	t.purityMu.Unlock()
+	if known {
+		return impure
+	}
+
+	impure = t.impureExpr(expr, seenSyms, seenFuncs)
+	t.purityMu.Lock()
+	t.purity[name] = impure
+	t.purityMu.Unlock()
+	return impure
+}
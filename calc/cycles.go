@@ -0,0 +1,153 @@
+package calc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl2/hcl"
+)
+
+// SetRefuseCycles changes whether Define and Batch.Commit refuse changes
+// that would create a dependency cycle. By default such changes are made
+// with a warning, and the symbols in the cycle have unknown values until it
+// is broken.
+func (t *Table) SetRefuseCycles(refuse bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.refuseCycles = refuse
+}
+
+// RefuseCycles returns true if Define and Batch.Commit refuse changes that
+// would create a dependency cycle.
+func (t *Table) RefuseCycles() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.refuseCycles
+}
+
+// cyclePath returns the shortest dependency cycle through the symbol with
+// the given name, starting and ending with that name, or nil if there is
+// none.
+//
+// This searches the symbols that depend on the given one, rather than those
+// it depends on, since a newly-defined symbol usually has no dependents
+// and so the search ends immediately.
+func (t *Table) cyclePath(name string) []string {
+	if t.reqs.Has(name, name) {
+		return []string{name, name}
+	}
+
+	// next records, for each symbol found, the symbol it requires on the
+	// way back to the given one.
+	next := map[string]string{name: ""}
+	queue := []string{name}
+	for len(queue) > 0 {
+		reqdName := queue[0]
+		queue = queue[1:]
+		for _, dependent := range t.reqdBy.AllFrom(reqdName).AppendNames(nil) {
+			if _, found := next[dependent]; found {
+				continue
+			}
+			next[dependent] = reqdName
+			if !t.reqs.Has(name, dependent) {
+				queue = append(queue, dependent)
+				continue
+			}
+
+			path := []string{name}
+			for step := dependent; step != ""; step = next[step] {
+				path = append(path, step)
+			}
+			return path
+		}
+	}
+	return nil
+}
+
+// cycleDiags returns diagnostics with the given severity describing the
+// given dependency cycle, as returned by cyclePath, with one for each
+// reference in the cycle.
+func (t *Table) cycleDiags(path []string, severity hcl.DiagnosticSeverity) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	desc := strings.Join(path, " → ")
+	for i := 0; i < len(path)-1; i++ {
+		name, reqdName := path[i], path[i+1]
+		diag := &hcl.Diagnostic{
+			Severity: severity,
+			Summary:  "Dependency cycle",
+			Detail:   fmt.Sprintf("The expression for %q refers to %q, which is part of the dependency cycle %s.", name, reqdName, desc),
+		}
+		for _, traversal := range t.syms[name].Variables() {
+			if traversal.RootName() == reqdName {
+				diag.Subject = traversal.SourceRange().Ptr()
+				break
+			}
+		}
+		diags = append(diags, diag)
+	}
+	return diags
+}
+
+// findCycles returns the dependency cycles among the given symbols and the
+// symbols they require, directly or indirectly. Each cycle is the sorted
+// names of the symbols that depend on each other, and the cycles are
+// sorted by their first names.
+//
+// This uses Tarjan's algorithm to find the strongly-connected components
+// of the dependency graph, each of which is a cycle if it has more than
+// one member or if its only member requires itself.
+func (t *Table) findCycles(from symbolSet) [][]string {
+	index := make(map[string]int)
+	low := make(map[string]int)
+	onStack := newSymbolSet()
+	var stack []string
+	var cycles [][]string
+
+	var connect func(name string)
+	connect = func(name string) {
+		index[name] = len(index)
+		low[name] = index[name]
+		stack = append(stack, name)
+		onStack.Add(name)
+
+		for reqdName := range t.reqs[name] {
+			if _, visited := index[reqdName]; !visited {
+				connect(reqdName)
+				if low[reqdName] < low[name] {
+					low[name] = low[reqdName]
+				}
+			} else if onStack.Has(reqdName) && index[reqdName] < low[name] {
+				low[name] = index[reqdName]
+			}
+		}
+
+		if low[name] != index[name] {
+			return
+		}
+		var component []string
+		for {
+			member := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack.Remove(member)
+			component = append(component, member)
+			if member == name {
+				break
+			}
+		}
+		if len(component) > 1 || t.reqs.Has(name, name) {
+			sort.Strings(component)
+			cycles = append(cycles, component)
+		}
+	}
+
+	for _, name := range from.AppendNames(nil) {
+		if _, visited := index[name]; !visited {
+			connect(name)
+		}
+	}
+	sort.Slice(cycles, func(i, j int) bool {
+		return cycles[i][0] < cycles[j][0]
+	})
+	return cycles
+}
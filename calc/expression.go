@@ -8,14 +8,67 @@ import (
 type Expression struct {
 	hcl.Expression
 	Source []byte
+
+	// vars caches the result of Variables, because finding the variables
+	// of a native syntax expression writes to its nodes and so can't be
+	// done while another goroutine is evaluating it.
+	vars []hcl.Traversal
+
+	// calls is the set of names of the functions that the expression
+	// calls, or nil if they can't be determined. This must be found before
+	// the expression is rewritten, since the arguments of can and try are
+	// hidden from later inspection.
+	calls symbolSet
+}
+
+// Variables returns the variables that the expression refers to.
+func (e Expression) Variables() []hcl.Traversal {
+	if e.vars != nil {
+		return e.vars
+	}
+	return e.Expression.Variables()
+}
+
+// withVars returns a copy of the given expression that has its variables
+// and function calls cached.
+func withVars(expr Expression) Expression {
+	if expr.vars == nil {
+		expr.vars = append([]hcl.Traversal{}, expr.Expression.Variables()...)
+	}
+	if expr.calls == nil {
+		if node, ok := expr.Expression.(hclsyntax.Node); ok {
+			expr.calls = functionCalls(node)
+		}
+	}
+	return expr
+}
+
+// functionCalls returns the names of the functions called within the given
+// node.
+func functionCalls(node hclsyntax.Node) symbolSet {
+	calls := newSymbolSet()
+	hclsyntax.VisitAll(node, func(node hclsyntax.Node) hcl.Diagnostics {
+		if call, ok := node.(*hclsyntax.FunctionCallExpr); ok {
+			calls.Add(call.Name)
+		}
+		return nil
+	})
+	return calls
 }
 
 func ParseExpression(src []byte, name string) (Expression, hcl.Diagnostics) {
 	expr, diags := hclsyntax.ParseExpression(src, name, hcl.Pos{Line: 1, Column: 1})
-	return Expression{
+	calls := functionCalls(expr)
+	if !diags.HasErrors() {
+		var rewriteDiags hcl.Diagnostics
+		expr, rewriteDiags = rewriteExpression(expr, src)
+		diags = append(diags, rewriteDiags...)
+	}
+	return withVars(Expression{
 		Expression: expr,
 		Source:     src,
-	}, diags
+		calls:      calls,
+	}), diags
 }
 
 func ParseExpressionString(src string, name string) (Expression, hcl.Diagnostics) {
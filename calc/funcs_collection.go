@@ -0,0 +1,1014 @@
+package calc
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+// The functions in this file are the collection functions of Terraform,
+// with the same names and behavior. Where Terraform accepts a list, these
+// also accept tuples and sets, since in practice the arguments are often
+// written as tuple constructors.
+
+// lengthFunc returns the number of elements in a collection or structural
+// value, or the number of characters in a string.
+var lengthFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "value",
+			Type: cty.DynamicPseudoType,
+		},
+	},
+	Type: func(args []cty.Value) (cty.Type, error) {
+		ty := args[0].Type()
+		if !(ty == cty.String || ty.IsCollectionType() || ty.IsTupleType() || ty.IsObjectType()) {
+			return cty.Number, function.NewArgErrorf(0, "must be a string, a collection or a structural value")
+		}
+		return cty.Number, nil
+	},
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		val := args[0]
+		switch ty := val.Type(); {
+		case ty == cty.String:
+			return stdlib.StrlenFunc.Call(args)
+		case ty.IsObjectType():
+			return cty.NumberIntVal(int64(len(ty.AttributeTypes()))), nil
+		default:
+			return val.Length(), nil
+		}
+	},
+})
+
+// reverseListFunc returns the elements of a sequence in reverse order.
+// This is unlike the reverse function of the minimal profile, which
+// reverses the characters of a string; Terraform calls that strrev.
+var reverseListFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "list",
+			Type: cty.DynamicPseudoType,
+		},
+	},
+	Type: func(args []cty.Value) (cty.Type, error) {
+		ty := args[0].Type()
+		switch {
+		case ty.IsTupleType():
+			etys := ty.TupleElementTypes()
+			rev := make([]cty.Type, len(etys))
+			for i, ety := range etys {
+				rev[len(etys)-1-i] = ety
+			}
+			return cty.Tuple(rev), nil
+		case ty.IsListType() || ty.IsSetType():
+			return cty.List(ty.ElementType()), nil
+		default:
+			return cty.DynamicPseudoType, function.NewArgErrorf(0, "must be a list, a set or a tuple")
+		}
+	},
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		elems := args[0].AsValueSlice()
+		rev := make([]cty.Value, len(elems))
+		for i, ev := range elems {
+			rev[len(elems)-1-i] = ev
+		}
+		if retType.IsTupleType() {
+			return cty.TupleVal(rev), nil
+		}
+		if len(rev) == 0 {
+			return cty.ListValEmpty(retType.ElementType()), nil
+		}
+		return cty.ListVal(rev), nil
+	},
+})
+
+var allTrueFunc = boolListFunc(true)
+var anyTrueFunc = boolListFunc(false)
+
+// boolListFunc builds a function that returns true if all of the elements
+// of a list of bools are true, if all is set, or otherwise if any are.
+// Null elements are treated as false.
+func boolListFunc(all bool) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "list",
+				Type: cty.DynamicPseudoType,
+			},
+		},
+		Type: function.StaticReturnType(cty.Bool),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			elems, err := sequenceArg(args[0], 0)
+			if err != nil {
+				return cty.UnknownVal(cty.Bool), err
+			}
+			for _, ev := range elems {
+				if !ev.IsKnown() {
+					return cty.UnknownVal(cty.Bool), nil
+				}
+				if !ev.IsNull() && ev.Type() != cty.Bool {
+					return cty.UnknownVal(cty.Bool), function.NewArgErrorf(0, "must contain only bool values")
+				}
+				isTrue := !ev.IsNull() && ev.True()
+				if isTrue != all {
+					return cty.BoolVal(!all), nil
+				}
+			}
+			return cty.BoolVal(all), nil
+		},
+	})
+}
+
+var chunkListFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "list",
+			Type: cty.DynamicPseudoType,
+		},
+		{
+			Name: "size",
+			Type: cty.Number,
+		},
+	},
+	Type: function.StaticReturnType(cty.DynamicPseudoType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		elems, err := sequenceArg(args[0], 0)
+		if err != nil {
+			return cty.DynamicVal, err
+		}
+		size, err := sizeArg(args[1], 1)
+		if err != nil {
+			return cty.DynamicVal, err
+		}
+
+		var chunks []cty.Value
+		if size == 0 {
+			// A size of zero means that all of the elements are in a
+			// single chunk.
+			size = len(elems)
+		}
+		for start := 0; start < len(elems); start += size {
+			end := start + size
+			if end > len(elems) {
+				end = len(elems)
+			}
+			chunk, err := listResult(elems[start:end])
+			if err != nil {
+				return cty.DynamicVal, function.NewArgError(0, err)
+			}
+			chunks = append(chunks, chunk)
+		}
+		return listResult(chunks)
+	},
+})
+
+var coalesceListFunc = function.New(&function.Spec{
+	VarParam: &function.Parameter{
+		Name: "lists",
+		Type: cty.DynamicPseudoType,
+	},
+	Type: function.StaticReturnType(cty.DynamicPseudoType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		if len(args) == 0 {
+			return cty.DynamicVal, fmt.Errorf("at least one list is required")
+		}
+		for i, arg := range args {
+			elems, err := sequenceArg(arg, i)
+			if err != nil {
+				return cty.DynamicVal, err
+			}
+			if len(elems) > 0 {
+				return arg, nil
+			}
+		}
+		return cty.DynamicVal, fmt.Errorf("no non-empty list was given")
+	},
+})
+
+// coalesceNonEmptyFunc is Terraform's coalesce function, which returns the
+// first of its arguments that is neither null nor an empty string. The
+// coalesce function of the minimal profile skips only null values.
+var coalesceNonEmptyFunc = function.New(&function.Spec{
+	VarParam: &function.Parameter{
+		Name:      "vals",
+		Type:      cty.DynamicPseudoType,
+		AllowNull: true,
+	},
+	Type: function.StaticReturnType(cty.DynamicPseudoType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		if len(args) == 0 {
+			return cty.DynamicVal, fmt.Errorf("at least one argument is required")
+		}
+		args, err := unifyElements(args)
+		if err != nil {
+			return cty.DynamicVal, err
+		}
+		for _, arg := range args {
+			if !arg.IsKnown() {
+				return cty.UnknownVal(arg.Type()), nil
+			}
+			if arg.IsNull() || (arg.Type() == cty.String && arg.AsString() == "") {
+				continue
+			}
+			return arg, nil
+		}
+		return cty.DynamicVal, fmt.Errorf("no non-null, non-empty-string arguments")
+	},
+})
+
+var compactFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "list",
+			Type: cty.List(cty.String),
+		},
+	},
+	Type: function.StaticReturnType(cty.List(cty.String)),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		var result []cty.Value
+		for it := args[0].ElementIterator(); it.Next(); {
+			_, ev := it.Element()
+			if ev.IsNull() || (ev.IsKnown() && ev.AsString() == "") {
+				continue
+			}
+			result = append(result, ev)
+		}
+		if len(result) == 0 {
+			return cty.ListValEmpty(cty.String), nil
+		}
+		return cty.ListVal(result), nil
+	},
+})
+
+var containsFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "list",
+			Type: cty.DynamicPseudoType,
+		},
+		{
+			Name: "value",
+			Type: cty.DynamicPseudoType,
+		},
+	},
+	Type: function.StaticReturnType(cty.Bool),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		i, err := indexOf(args[0], args[1])
+		if err != nil {
+			return cty.UnknownVal(cty.Bool), err
+		}
+		return cty.BoolVal(i >= 0), nil
+	},
+})
+
+// indexOfFunc is Terraform's index function, which returns the index of a
+// value in a list. It is unlike the index function of cty, which returns
+// the element at an index.
+var indexOfFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "list",
+			Type: cty.DynamicPseudoType,
+		},
+		{
+			Name: "value",
+			Type: cty.DynamicPseudoType,
+		},
+	},
+	Type: function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		i, err := indexOf(args[0], args[1])
+		if err != nil {
+			return cty.UnknownVal(cty.Number), err
+		}
+		if i < 0 {
+			return cty.UnknownVal(cty.Number), fmt.Errorf("item not found")
+		}
+		return cty.NumberIntVal(int64(i)), nil
+	},
+})
+
+// indexOf returns the index of the first element of the given sequence that
+// is equal to the given value, or -1 if there is none.
+func indexOf(list, val cty.Value) (int, error) {
+	elems, err := sequenceArg(list, 0)
+	if err != nil {
+		return -1, err
+	}
+	for i, ev := range elems {
+		if valuesEqual(ev, val) {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+// valuesEqual compares two values in the same way as the == operator, so
+// values of different types are never equal.
+func valuesEqual(a, b cty.Value) bool {
+	if !a.IsWhollyKnown() || !b.IsWhollyKnown() {
+		return false
+	}
+	return a.Equals(b).True()
+}
+
+var distinctFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "list",
+			Type: cty.DynamicPseudoType,
+		},
+	},
+	Type: function.StaticReturnType(cty.DynamicPseudoType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		elems, err := sequenceArg(args[0], 0)
+		if err != nil {
+			return cty.DynamicVal, err
+		}
+		var result []cty.Value
+	Elems:
+		for _, ev := range elems {
+			for _, seen := range result {
+				if valuesEqual(ev, seen) {
+					continue Elems
+				}
+			}
+			result = append(result, ev)
+		}
+		return listResult(result)
+	},
+})
+
+// elementFunc returns the element at the given index of a list, wrapping
+// around to the start if the index is greater than the length.
+var elementFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "list",
+			Type: cty.DynamicPseudoType,
+		},
+		{
+			Name: "index",
+			Type: cty.Number,
+		},
+	},
+	Type: function.StaticReturnType(cty.DynamicPseudoType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		elems, err := sequenceArg(args[0], 0)
+		if err != nil {
+			return cty.DynamicVal, err
+		}
+		if len(elems) == 0 {
+			return cty.DynamicVal, function.NewArgErrorf(0, "cannot use element function with an empty list")
+		}
+		idx, err := sizeArg(args[1], 1)
+		if err != nil {
+			return cty.DynamicVal, err
+		}
+		return elems[idx%len(elems)], nil
+	},
+})
+
+var flattenFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "list",
+			Type: cty.DynamicPseudoType,
+		},
+	},
+	Type: function.StaticReturnType(cty.DynamicPseudoType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		if _, err := sequenceArg(args[0], 0); err != nil {
+			return cty.DynamicVal, err
+		}
+		var result []cty.Value
+		var flatten func(val cty.Value)
+		flatten = func(val cty.Value) {
+			ty := val.Type()
+			if !val.IsNull() && (ty.IsListType() || ty.IsSetType() || ty.IsTupleType()) {
+				for _, ev := range val.AsValueSlice() {
+					flatten(ev)
+				}
+				return
+			}
+			result = append(result, val)
+		}
+		flatten(args[0])
+		return tupleResult(result), nil
+	},
+})
+
+var keysFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "map",
+			Type: cty.DynamicPseudoType,
+		},
+	},
+	Type: function.StaticReturnType(cty.List(cty.String)),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		names, _, err := mappingArg(args[0], 0)
+		if err != nil {
+			return cty.UnknownVal(retType), err
+		}
+		if len(names) == 0 {
+			return cty.ListValEmpty(cty.String), nil
+		}
+		vals := make([]cty.Value, len(names))
+		for i, name := range names {
+			vals[i] = cty.StringVal(name)
+		}
+		return cty.ListVal(vals), nil
+	},
+})
+
+var valuesFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "map",
+			Type: cty.DynamicPseudoType,
+		},
+	},
+	Type: function.StaticReturnType(cty.DynamicPseudoType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		names, attrs, err := mappingArg(args[0], 0)
+		if err != nil {
+			return cty.DynamicVal, err
+		}
+		vals := make([]cty.Value, len(names))
+		for i, name := range names {
+			vals[i] = attrs[name]
+		}
+		if args[0].Type().IsObjectType() {
+			return cty.TupleVal(vals), nil
+		}
+		if len(vals) == 0 {
+			return cty.ListValEmpty(args[0].Type().ElementType()), nil
+		}
+		return cty.ListVal(vals), nil
+	},
+})
+
+var lookupFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "map",
+			Type: cty.DynamicPseudoType,
+		},
+		{
+			Name: "key",
+			Type: cty.String,
+		},
+	},
+	VarParam: &function.Parameter{
+		Name:      "default",
+		Type:      cty.DynamicPseudoType,
+		AllowNull: true,
+	},
+	Type: function.StaticReturnType(cty.DynamicPseudoType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		if len(args) > 3 {
+			return cty.DynamicVal, fmt.Errorf("lookup accepts at most three arguments")
+		}
+		_, attrs, err := mappingArg(args[0], 0)
+		if err != nil {
+			return cty.DynamicVal, err
+		}
+		key := args[1].AsString()
+		if val, exists := attrs[key]; exists {
+			return val, nil
+		}
+		if len(args) == 3 {
+			return args[2], nil
+		}
+		return cty.DynamicVal, function.NewArgErrorf(1, "the given map has no element with key %q", key)
+	},
+})
+
+// mergeFunc merges maps and objects, with later arguments taking precedence
+// over earlier ones. The result is a map if all of the arguments are maps
+// and their elements all have the same type, or otherwise an object.
+var mergeFunc = function.New(&function.Spec{
+	VarParam: &function.Parameter{
+		Name:      "maps",
+		Type:      cty.DynamicPseudoType,
+		AllowNull: true,
+	},
+	Type: function.StaticReturnType(cty.DynamicPseudoType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		allMaps := true
+		merged := make(map[string]cty.Value)
+		for i, arg := range args {
+			if arg.IsNull() {
+				continue
+			}
+			if !arg.Type().IsMapType() {
+				allMaps = false
+			}
+			_, attrs, err := mappingArg(arg, i)
+			if err != nil {
+				return cty.DynamicVal, err
+			}
+			for name, val := range attrs {
+				merged[name] = val
+			}
+		}
+		if len(merged) == 0 {
+			return cty.EmptyObjectVal, nil
+		}
+		if allMaps {
+			if val, err := convertStructural(cty.ObjectVal(merged), cty.Map(cty.DynamicPseudoType)); err == nil {
+				return val, nil
+			}
+		}
+		return cty.ObjectVal(merged), nil
+	},
+})
+
+var oneFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "list",
+			Type: cty.DynamicPseudoType,
+		},
+	},
+	Type: function.StaticReturnType(cty.DynamicPseudoType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		elems, err := sequenceArg(args[0], 0)
+		if err != nil {
+			return cty.DynamicVal, err
+		}
+		switch len(elems) {
+		case 0:
+			ty := args[0].Type()
+			if ty.IsListType() || ty.IsSetType() {
+				return cty.NullVal(ty.ElementType()), nil
+			}
+			return cty.NullVal(cty.DynamicPseudoType), nil
+		case 1:
+			return elems[0], nil
+		default:
+			return cty.DynamicVal, function.NewArgErrorf(0, "must be a list, set, or tuple value with either zero or one elements")
+		}
+	},
+})
+
+// rangeFunc generates a list of numbers, given either just a limit, a
+// start and a limit, or a start, a limit and a step.
+var rangeFunc = function.New(&function.Spec{
+	VarParam: &function.Parameter{
+		Name: "params",
+		Type: cty.Number,
+	},
+	Type: function.StaticReturnType(cty.List(cty.Number)),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		start := big.NewFloat(0)
+		step := big.NewFloat(1)
+		var limit *big.Float
+		switch len(args) {
+		case 1:
+			limit = args[0].AsBigFloat()
+		case 2:
+			start, limit = args[0].AsBigFloat(), args[1].AsBigFloat()
+		case 3:
+			start, limit, step = args[0].AsBigFloat(), args[1].AsBigFloat(), args[2].AsBigFloat()
+		default:
+			return cty.UnknownVal(retType), fmt.Errorf("must have one, two, or three arguments")
+		}
+		if step.Sign() == 0 {
+			return cty.UnknownVal(retType), function.NewArgErrorf(2, "step must not be zero")
+		}
+		down := step.Sign() < 0
+		if start.Cmp(limit) > 0 && !down {
+			return cty.UnknownVal(retType), fmt.Errorf("when start is greater than limit, step must be negative")
+		}
+		if start.Cmp(limit) < 0 && down {
+			return cty.UnknownVal(retType), fmt.Errorf("when start is less than limit, step must be positive")
+		}
+
+		const maxElems = 1024
+		var vals []cty.Value
+		for v := new(big.Float).Set(start); (!down && v.Cmp(limit) < 0) || (down && v.Cmp(limit) > 0); v.Add(v, step) {
+			if len(vals) >= maxElems {
+				return cty.UnknownVal(retType), fmt.Errorf("more than %d values were generated; either decrease the difference between start and end or use a smaller step", maxElems)
+			}
+			vals = append(vals, cty.NumberVal(new(big.Float).Set(v)))
+		}
+		if len(vals) == 0 {
+			return cty.ListValEmpty(cty.Number), nil
+		}
+		return cty.ListVal(vals), nil
+	},
+})
+
+var sliceFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "list",
+			Type: cty.DynamicPseudoType,
+		},
+		{
+			Name: "start_index",
+			Type: cty.Number,
+		},
+		{
+			Name: "end_index",
+			Type: cty.Number,
+		},
+	},
+	Type: function.StaticReturnType(cty.DynamicPseudoType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		elems, err := sequenceArg(args[0], 0)
+		if err != nil {
+			return cty.DynamicVal, err
+		}
+		start, err := sizeArg(args[1], 1)
+		if err != nil {
+			return cty.DynamicVal, err
+		}
+		end, err := sizeArg(args[2], 2)
+		if err != nil {
+			return cty.DynamicVal, err
+		}
+		if end > len(elems) {
+			return cty.DynamicVal, function.NewArgErrorf(2, "end index must not be greater than the length of the list")
+		}
+		if start > end {
+			return cty.DynamicVal, function.NewArgErrorf(1, "start index must not be greater than end index")
+		}
+		if args[0].Type().IsTupleType() {
+			return cty.TupleVal(elems[start:end]), nil
+		}
+		if start == end {
+			ty := args[0].Type()
+			if ty.IsListType() || ty.IsSetType() {
+				return cty.ListValEmpty(ty.ElementType()), nil
+			}
+		}
+		return listResult(elems[start:end])
+	},
+})
+
+// sortFunc sorts a list of strings lexicographically.
+var sortFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "list",
+			Type: cty.List(cty.String),
+		},
+	},
+	Type: function.StaticReturnType(cty.List(cty.String)),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		if args[0].LengthInt() == 0 {
+			return args[0], nil
+		}
+		if !args[0].IsWhollyKnown() {
+			return cty.UnknownVal(retType), nil
+		}
+		var strs []string
+		for it := args[0].ElementIterator(); it.Next(); {
+			_, ev := it.Element()
+			if ev.IsNull() {
+				return cty.UnknownVal(retType), function.NewArgErrorf(0, "must not contain null values")
+			}
+			strs = append(strs, ev.AsString())
+		}
+		sort.Strings(strs)
+		vals := make([]cty.Value, len(strs))
+		for i, str := range strs {
+			vals[i] = cty.StringVal(str)
+		}
+		return cty.ListVal(vals), nil
+	},
+})
+
+var sumFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "list",
+			Type: cty.DynamicPseudoType,
+		},
+	},
+	Type: function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		elems, err := sequenceArg(args[0], 0)
+		if err != nil {
+			return cty.UnknownVal(cty.Number), err
+		}
+		if len(elems) == 0 {
+			return cty.UnknownVal(cty.Number), function.NewArgErrorf(0, "cannot sum an empty list")
+		}
+		total := new(big.Float)
+		for _, ev := range elems {
+			if !ev.IsKnown() {
+				return cty.UnknownVal(cty.Number), nil
+			}
+			if ev.IsNull() || ev.Type() != cty.Number {
+				return cty.UnknownVal(cty.Number), function.NewArgErrorf(0, "must contain only numbers")
+			}
+			total.Add(total, ev.AsBigFloat())
+		}
+		return cty.NumberVal(total), nil
+	},
+})
+
+// transposeFunc swaps the keys and values of a map of lists of strings.
+var transposeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "map",
+			Type: cty.Map(cty.List(cty.String)),
+		},
+	},
+	Type: function.StaticReturnType(cty.Map(cty.List(cty.String))),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		if !args[0].IsWhollyKnown() {
+			return cty.UnknownVal(retType), nil
+		}
+		result := make(map[string][]cty.Value)
+		for it := args[0].ElementIterator(); it.Next(); {
+			key, list := it.Element()
+			if list.IsNull() {
+				continue
+			}
+			for lit := list.ElementIterator(); lit.Next(); {
+				_, ev := lit.Element()
+				if ev.IsNull() {
+					return cty.UnknownVal(retType), function.NewArgErrorf(0, "lists must not contain null values")
+				}
+				result[ev.AsString()] = append(result[ev.AsString()], key)
+			}
+		}
+		if len(result) == 0 {
+			return cty.MapValEmpty(cty.List(cty.String)), nil
+		}
+		vals := make(map[string]cty.Value, len(result))
+		for key, list := range result {
+			vals[key] = cty.ListVal(list)
+		}
+		return cty.MapVal(vals), nil
+	},
+})
+
+// zipMapFunc constructs a map from a list of keys and a corresponding list
+// of values. The result is an object if the values are given as a tuple.
+var zipMapFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "keys",
+			Type: cty.List(cty.String),
+		},
+		{
+			Name: "values",
+			Type: cty.DynamicPseudoType,
+		},
+	},
+	Type: function.StaticReturnType(cty.DynamicPseudoType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		if !args[0].IsWhollyKnown() {
+			return cty.DynamicVal, nil
+		}
+		keys := args[0].AsValueSlice()
+		vals, err := sequenceArg(args[1], 1)
+		if err != nil {
+			return cty.DynamicVal, err
+		}
+		if len(keys) != len(vals) {
+			return cty.DynamicVal, fmt.Errorf("number of keys (%d) does not match number of values (%d)", len(keys), len(vals))
+		}
+		attrs := make(map[string]cty.Value, len(keys))
+		for i, key := range keys {
+			if key.IsNull() {
+				return cty.DynamicVal, function.NewArgErrorf(0, "must not contain null values")
+			}
+			attrs[key.AsString()] = vals[i]
+		}
+		if args[1].Type().IsTupleType() {
+			return cty.ObjectVal(attrs), nil
+		}
+		if len(attrs) == 0 {
+			return cty.MapValEmpty(args[1].Type().ElementType()), nil
+		}
+		return cty.MapVal(attrs), nil
+	},
+})
+
+// matchKeysFunc returns the elements of a list of values whose
+// corresponding elements in a list of keys are in the search set.
+var matchKeysFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "values",
+			Type: cty.DynamicPseudoType,
+		},
+		{
+			Name: "keys",
+			Type: cty.DynamicPseudoType,
+		},
+		{
+			Name: "searchset",
+			Type: cty.DynamicPseudoType,
+		},
+	},
+	Type: function.StaticReturnType(cty.DynamicPseudoType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		vals, err := sequenceArg(args[0], 0)
+		if err != nil {
+			return cty.DynamicVal, err
+		}
+		keys, err := sequenceArg(args[1], 1)
+		if err != nil {
+			return cty.DynamicVal, err
+		}
+		if len(keys) != len(vals) {
+			return cty.DynamicVal, fmt.Errorf("length of keys and values should be equal")
+		}
+		var result []cty.Value
+		for i, key := range keys {
+			found, err := indexOf(args[2], key)
+			if err != nil {
+				return cty.DynamicVal, function.NewArgError(2, err)
+			}
+			if found >= 0 {
+				result = append(result, vals[i])
+			}
+		}
+		if len(result) == 0 {
+			ty := args[0].Type()
+			if ty.IsListType() || ty.IsSetType() {
+				return cty.ListValEmpty(ty.ElementType()), nil
+			}
+		}
+		return listResult(result)
+	},
+})
+
+var setUnionFunc = setsFunc(stdlib.SetUnionFunc)
+var setIntersectionFunc = setsFunc(stdlib.SetIntersectionFunc)
+var setSubtractFunc = setsFunc(stdlib.SetSubtractFunc)
+
+// setsFunc wraps one of the set functions of cty so that its arguments may
+// also be given as lists or tuples, which are converted to sets.
+func setsFunc(f function.Function) function.Function {
+	return function.New(&function.Spec{
+		VarParam: &function.Parameter{
+			Name: "sets",
+			Type: cty.DynamicPseudoType,
+		},
+		Type: function.StaticReturnType(cty.DynamicPseudoType),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			sets := make([]cty.Value, len(args))
+			for i, arg := range args {
+				if _, err := sequenceArg(arg, i); err != nil {
+					return cty.DynamicVal, err
+				}
+				set, err := convertStructural(arg, cty.Set(cty.DynamicPseudoType))
+				if err != nil {
+					return cty.DynamicVal, function.NewArgError(i, err)
+				}
+				sets[i] = set
+			}
+			return f.Call(sets)
+		},
+	})
+}
+
+// setProductFunc returns every combination of the elements of the given
+// sequences. The result is a set if all of the arguments are sets, or
+// otherwise a list.
+var setProductFunc = function.New(&function.Spec{
+	VarParam: &function.Parameter{
+		Name: "sets",
+		Type: cty.DynamicPseudoType,
+	},
+	Type: function.StaticReturnType(cty.DynamicPseudoType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		if len(args) < 2 {
+			return cty.DynamicVal, fmt.Errorf("at least two arguments are required")
+		}
+		allSets := true
+		combos := [][]cty.Value{nil}
+		for i, arg := range args {
+			elems, err := sequenceArg(arg, i)
+			if err != nil {
+				return cty.DynamicVal, err
+			}
+			if !arg.Type().IsSetType() {
+				allSets = false
+			}
+			var next [][]cty.Value
+			for _, combo := range combos {
+				for _, ev := range elems {
+					c := make([]cty.Value, len(combo), len(combo)+1)
+					copy(c, combo)
+					next = append(next, append(c, ev))
+				}
+			}
+			combos = next
+		}
+
+		// Each combination is a list if its elements all have the same
+		// type, or otherwise a tuple.
+		products := make([]cty.Value, len(combos))
+		for i, combo := range combos {
+			sameType := true
+			for _, ev := range combo[1:] {
+				if !ev.Type().Equals(combo[0].Type()) {
+					sameType = false
+				}
+			}
+			if sameType {
+				products[i] = cty.ListVal(combo)
+			} else {
+				products[i] = cty.TupleVal(combo)
+			}
+		}
+		if len(products) == 0 {
+			if allSets {
+				return cty.SetValEmpty(cty.DynamicPseudoType), nil
+			}
+			return cty.ListValEmpty(cty.DynamicPseudoType), nil
+		}
+		products, err := unifyElements(products)
+		if err != nil {
+			return tupleResult(products), nil
+		}
+		if allSets {
+			return cty.SetVal(products), nil
+		}
+		return cty.ListVal(products), nil
+	},
+})
+
+// sequenceArg returns the elements of an argument that must be a list, a
+// set or a tuple.
+func sequenceArg(val cty.Value, argIdx int) ([]cty.Value, error) {
+	ty := val.Type()
+	if !(ty.IsListType() || ty.IsSetType() || ty.IsTupleType()) {
+		return nil, function.NewArgErrorf(argIdx, "must be a list, a set or a tuple")
+	}
+	if val.IsNull() {
+		return nil, function.NewArgErrorf(argIdx, "must not be null")
+	}
+	return val.AsValueSlice(), nil
+}
+
+// mappingArg returns the sorted keys and the elements of an argument that
+// must be a map or an object.
+func mappingArg(val cty.Value, argIdx int) ([]string, map[string]cty.Value, error) {
+	ty := val.Type()
+	if !(ty.IsMapType() || ty.IsObjectType()) {
+		return nil, nil, function.NewArgErrorf(argIdx, "must be a map or an object")
+	}
+	if val.IsNull() {
+		return nil, nil, function.NewArgErrorf(argIdx, "must not be null")
+	}
+	attrs := valueAttrs(val)
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, attrs, nil
+}
+
+// sizeArg returns the value of an argument that must be a whole number
+// that isn't negative.
+func sizeArg(val cty.Value, argIdx int) (int, error) {
+	n, err := intArg(val, argIdx)
+	if err != nil {
+		return 0, err
+	}
+	if n.Sign() < 0 {
+		return 0, function.NewArgErrorf(argIdx, "must not be negative")
+	}
+	if n.BitLen() > 31 {
+		return 0, function.NewArgErrorf(argIdx, "must be less than 2147483648")
+	}
+	return int(n.Int64()), nil
+}
+
+// listResult returns a list of the given elements, converted to a common
+// type, or an empty list of unknown type if there are no elements.
+func listResult(elems []cty.Value) (cty.Value, error) {
+	if len(elems) == 0 {
+		return cty.ListValEmpty(cty.DynamicPseudoType), nil
+	}
+	elems, err := unifyElements(elems)
+	if err != nil {
+		return cty.DynamicVal, err
+	}
+	return cty.ListVal(elems), nil
+}
+
+// tupleResult returns a tuple of the given elements.
+func tupleResult(elems []cty.Value) cty.Value {
+	if len(elems) == 0 {
+		return cty.EmptyTupleVal
+	}
+	return cty.TupleVal(elems)
+}
@@ -0,0 +1,290 @@
+package calc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"math/big"
+	"net/url"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var base64EncodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "str",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.StringVal(base64.StdEncoding.EncodeToString([]byte(args[0].AsString()))), nil
+	},
+})
+
+// base64GzipFunc compresses a string with gzip and then encodes the result
+// as base64.
+var base64GzipFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "str",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		var buf bytes.Buffer
+		w, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if _, err := w.Write([]byte(args[0].AsString())); err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+		if err := w.Flush(); err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+		if err := w.Close(); err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+		return cty.StringVal(base64.StdEncoding.EncodeToString(buf.Bytes())), nil
+	},
+})
+
+var base64DecodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "str",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		buf, err := base64.StdEncoding.DecodeString(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), function.NewArgErrorf(0, "invalid base64 data: %s", err)
+		}
+		if !utf8.Valid(buf) {
+			return cty.UnknownVal(cty.String), function.NewArgErrorf(0, "decoded data is not valid UTF-8")
+		}
+		return cty.StringVal(string(buf)), nil
+	},
+})
+
+var urlEncodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "str",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.StringVal(url.QueryEscape(args[0].AsString())), nil
+	},
+})
+
+var yamlEncodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name:      "val",
+			Type:      cty.DynamicPseudoType,
+			AllowNull: true,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		val := args[0]
+		if !val.IsWhollyKnown() {
+			return cty.UnknownVal(cty.String), nil
+		}
+		buf, err := yaml.Marshal(yamlNative(val))
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+		return cty.StringVal(string(buf)), nil
+	},
+})
+
+// quotedYAMLEncodeFunc is yamlencode as Terraform implements it, which
+// writes every string in double quotes, including the keys of mappings,
+// except for strings with line breaks, which become literal blocks where
+// YAML allows it. See yaml_emitter.go for more details.
+var quotedYAMLEncodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name:      "val",
+			Type:      cty.DynamicPseudoType,
+			AllowNull: true,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		val := args[0]
+		if !val.IsWhollyKnown() {
+			return cty.UnknownVal(cty.String), nil
+		}
+		return cty.StringVal(quotedYAML(val)), nil
+	},
+})
+
+var yamlDecodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "str",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.DynamicPseudoType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		var raw interface{}
+		err := yaml.Unmarshal([]byte(args[0].AsString()), &raw)
+		if err != nil {
+			return cty.DynamicVal, function.NewArgErrorf(0, "invalid YAML: %s", err)
+		}
+		val, err := yamlValue(raw)
+		if err != nil {
+			return cty.DynamicVal, function.NewArgError(0, err)
+		}
+		return val, nil
+	},
+})
+
+// yamlNative converts a wholly-known cty value into a Go value that the
+// YAML encoder will serialize in the natural way for its type. Objects and
+// maps become mappings with their keys in lexicographical order, so that
+// the result is stable.
+func yamlNative(val cty.Value) interface{} {
+	if val.IsNull() {
+		return nil
+	}
+
+	ty := val.Type()
+	switch {
+	case ty == cty.String:
+		return val.AsString()
+	case ty == cty.Bool:
+		return val.True()
+	case ty == cty.Number:
+		bf := val.AsBigFloat()
+		if bf.IsInt() {
+			if i, acc := bf.Int64(); acc == big.Exact {
+				return i
+			}
+		}
+		f, _ := bf.Float64()
+		return f
+	case ty.IsObjectType() || ty.IsMapType():
+		attrs := valueAttrs(val)
+		keys := make([]string, 0, len(attrs))
+		for k := range attrs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		ret := make(yaml.MapSlice, len(keys))
+		for i, k := range keys {
+			ret[i] = yaml.MapItem{
+				Key:   k,
+				Value: yamlNative(attrs[k]),
+			}
+		}
+		return ret
+	case ty.IsListType() || ty.IsSetType() || ty.IsTupleType():
+		ret := make([]interface{}, 0, val.LengthInt())
+		for it := val.ElementIterator(); it.Next(); {
+			_, ev := it.Element()
+			ret = append(ret, yamlNative(ev))
+		}
+		return ret
+	default:
+		// Should never happen, since the above covers all of the types
+		// that can be produced by expressions.
+		return fmt.Sprintf("%#v", val)
+	}
+}
+
+// valueAttrs returns the attributes of an object value or the elements of
+// a map value, which must be known and not null.
+func valueAttrs(val cty.Value) map[string]cty.Value {
+	ty := val.Type()
+	if ty.IsObjectType() {
+		attrs := make(map[string]cty.Value, len(ty.AttributeTypes()))
+		for name := range ty.AttributeTypes() {
+			attrs[name] = val.GetAttr(name)
+		}
+		return attrs
+	}
+
+	attrs := make(map[string]cty.Value, val.LengthInt())
+	for it := val.ElementIterator(); it.Next(); {
+		k, v := it.Element()
+		attrs[k.AsString()] = v
+	}
+	return attrs
+}
+
+// yamlValue converts a value produced by the YAML decoder into a cty value,
+// preserving the types of scalars. Mappings become objects and sequences
+// become tuples, since YAML allows their elements to have different types.
+func yamlValue(raw interface{}) (cty.Value, error) {
+	switch tv := raw.(type) {
+	case nil:
+		return cty.NullVal(cty.DynamicPseudoType), nil
+	case string:
+		return cty.StringVal(tv), nil
+	case bool:
+		return cty.BoolVal(tv), nil
+	case int:
+		return cty.NumberIntVal(int64(tv)), nil
+	case int64:
+		return cty.NumberIntVal(tv), nil
+	case uint64:
+		return cty.NumberUIntVal(tv), nil
+	case float64:
+		// The calculator's numbers are always finite.
+		switch {
+		case math.IsNaN(tv):
+			return cty.DynamicVal, fmt.Errorf(".nan is not a real number")
+		case math.IsInf(tv, 1):
+			return cty.DynamicVal, fmt.Errorf(".inf is not a real number")
+		case math.IsInf(tv, -1):
+			return cty.DynamicVal, fmt.Errorf("-.inf is not a real number")
+		}
+		return cty.NumberFloatVal(tv), nil
+	case []interface{}:
+		elems := make([]cty.Value, len(tv))
+		for i, raw := range tv {
+			ev, err := yamlValue(raw)
+			if err != nil {
+				return cty.DynamicVal, err
+			}
+			elems[i] = ev
+		}
+		return cty.TupleVal(elems), nil
+	case map[interface{}]interface{}:
+		attrs := make(map[string]cty.Value, len(tv))
+		for rawK, rawV := range tv {
+			// Object attribute names are always strings, so we'll
+			// stringify any scalar keys, such as port numbers.
+			var k string
+			switch rawK.(type) {
+			case []interface{}, map[interface{}]interface{}:
+				return cty.DynamicVal, fmt.Errorf("mapping keys must be scalar values")
+			default:
+				k = fmt.Sprint(rawK)
+			}
+			av, err := yamlValue(rawV)
+			if err != nil {
+				return cty.DynamicVal, err
+			}
+			attrs[k] = av
+		}
+		return cty.ObjectVal(attrs), nil
+	default:
+		return cty.DynamicVal, fmt.Errorf("unsupported YAML value of type %T", raw)
+	}
+}
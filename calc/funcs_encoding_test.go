@@ -0,0 +1,75 @@
+package calc
+
+import (
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// TestYAMLDecodeNonFinite checks that yamldecode rejects the YAML numbers
+// that the calculator can't represent, wherever they appear.
+func TestYAMLDecodeNonFinite(t *testing.T) {
+	tests := map[string]string{
+		".nan":            ".nan is not a real number",
+		".NaN":            ".nan is not a real number",
+		".inf":            ".inf is not a real number",
+		"+.Inf":           ".inf is not a real number",
+		"-.inf":           "-.inf is not a real number",
+		"[1, .inf]":       ".inf is not a real number",
+		"{a: {b: -.INF}}": "-.inf is not a real number",
+	}
+	for src, want := range tests {
+		_, err := yamlDecodeFunc.Call([]cty.Value{cty.StringVal(src)})
+		argErr, ok := err.(function.ArgError)
+		if !ok {
+			t.Errorf("%s: got error %#v, want a function.ArgError", src, err)
+			continue
+		}
+		if argErr.Index != 0 || argErr.Error() != want {
+			t.Errorf("%s: wrong error %q for argument %d, want %q", src, argErr.Error(), argErr.Index, want)
+		}
+	}
+
+	got, err := yamlDecodeFunc.Call([]cty.Value{cty.StringVal("1.5")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.RawEquals(cty.NumberFloatVal(1.5)) {
+		t.Errorf("wrong result %#v for a finite number", got)
+	}
+}
+
+// TestYAMLEncodeTerraform checks yamlencode in the profiles that take it
+// from Terraform against the examples in Terraform's documentation, along
+// with a string that has line breaks.
+func TestYAMLEncodeTerraform(t *testing.T) {
+	tests := map[string]string{
+		`{"a":"b", "c":"d"}`:                              "\"a\": \"b\"\n\"c\": \"d\"\n",
+		`{"foo":[1, 2, 3], "bar": "baz"}`:                 "\"bar\": \"baz\"\n\"foo\":\n- 1\n- 2\n- 3\n",
+		`{"foo":[1, {"a":"b","c":"d"}, 3], "bar": "baz"}`: "\"bar\": \"baz\"\n\"foo\":\n- 1\n- \"a\": \"b\"\n  \"c\": \"d\"\n- 3\n",
+		`{"a":"line 1\nline 2\n", "b":[]}`:                "\"a\": |\n  line 1\n  line 2\n\"b\": []\n",
+	}
+	for _, profile := range []string{"terraform", "all"} {
+		table := NewTable(WithProfile(profile))
+		for src, want := range tests {
+			got, diags := table.Eval(mustParse(t, "yamlencode("+src+")"))
+			if diags.HasErrors() {
+				t.Errorf("%s: %s: %s", profile, src, diags.Error())
+				continue
+			}
+			if got.AsString() != want {
+				t.Errorf("%s: %s: wrong result\ngot:  %q\nwant: %q", profile, src, got.AsString(), want)
+			}
+		}
+	}
+
+	// The calculator's own yamlencode quotes only where YAML requires it.
+	got, diags := NewTable().Eval(mustParse(t, `yamlencode({"a":"b"})`))
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	if got.AsString() != "a: b\n" {
+		t.Errorf("wrong result %q from the minimal profile", got.AsString())
+	}
+}
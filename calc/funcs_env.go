@@ -0,0 +1,74 @@
+package calc
+
+import (
+	"os"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// Environment variables can only be read if the host application has
+// explicitly allowed them by name, so that definitions can't read secrets
+// from the environment unexpectedly. See Table.AllowEnv.
+
+// envLookup returns the value of the given environment variable and whether
+// it is set, or an error if it is not allowed to be read.
+type envLookup func(name string) (string, bool, error)
+
+// envFunc returns a function that returns the value of an environment
+// variable, or the given default if it isn't set.
+func envFunc(lookup envLookup) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "name",
+				Type: cty.String,
+			},
+			{
+				Name:      "default",
+				Type:      cty.String,
+				AllowNull: true,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			val, set, err := lookup(args[0].AsString())
+			if err != nil {
+				return cty.UnknownVal(cty.String), function.NewArgError(0, err)
+			}
+			if !set {
+				return args[1], nil
+			}
+			return cty.StringVal(val), nil
+		},
+	})
+}
+
+// envVarExpr is the expression of each symbol defined by AllowEnv. It
+// reads the environment variable directly rather than calling env, so
+// that the symbol has a value whatever the table's function profile is.
+type envVarExpr struct {
+	name string
+	rng  hcl.Range
+}
+
+func (e envVarExpr) Value(ctx *hcl.EvalContext) (cty.Value, hcl.Diagnostics) {
+	val, set := os.LookupEnv(e.name)
+	if !set {
+		return cty.NullVal(cty.String), nil
+	}
+	return cty.StringVal(val), nil
+}
+
+func (e envVarExpr) Variables() []hcl.Traversal {
+	return nil
+}
+
+func (e envVarExpr) Range() hcl.Range {
+	return e.rng
+}
+
+func (e envVarExpr) StartRange() hcl.Range {
+	return e.rng
+}
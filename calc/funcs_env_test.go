@@ -0,0 +1,37 @@
+package calc
+
+import (
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// TestAllowEnvProfiles checks that the symbols defined by AllowEnv have
+// values in every profile, including those without the env function.
+func TestAllowEnvProfiles(t *testing.T) {
+	t.Setenv("HCLCALC_TEST_SET", "hello")
+
+	for _, profile := range ProfileNames() {
+		table := NewTable()
+		if err := table.SetProfile(profile); err != nil {
+			t.Fatal(err)
+		}
+		if diags := table.AllowEnv("HCLCALC_TEST_SET", "HCLCALC_TEST_UNSET"); diags.HasErrors() {
+			t.Fatalf("%s: %s", profile, diags.Error())
+		}
+
+		got, diags := table.Value("HCLCALC_TEST_SET")
+		if diags.HasErrors() {
+			t.Errorf("%s: %s", profile, diags.Error())
+		} else if !got.RawEquals(cty.StringVal("hello")) {
+			t.Errorf("%s: wrong value %#v for a set variable", profile, got)
+		}
+
+		got, diags = table.Value("HCLCALC_TEST_UNSET")
+		if diags.HasErrors() {
+			t.Errorf("%s: %s", profile, diags.Error())
+		} else if !got.RawEquals(cty.NullVal(cty.String)) {
+			t.Errorf("%s: wrong value %#v for an unset variable", profile, got)
+		}
+	}
+}
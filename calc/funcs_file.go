@@ -0,0 +1,455 @@
+package calc
+
+import (
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// The functions in this file may only access files within the base
+// directory of the table, so that definitions can't read arbitrary files
+// from elsewhere on the system. Paths are interpreted relative to that
+// directory, and any path that would refer to a file outside of it, whether
+// directly or via a symbolic link, is rejected.
+
+// pathFunc resolves a path given to one of the file functions to the path
+// of a file within the base directory, or returns an error if that isn't
+// possible.
+type pathFunc func(path string) (string, error)
+
+// sandboxPath resolves the given path relative to the given base directory,
+// returning an error if the result is not within that directory.
+func sandboxPath(base, path string) (string, error) {
+	base, err := filepath.Abs(base)
+	if err != nil {
+		return "", err
+	}
+	if realBase, err := filepath.EvalSymlinks(base); err == nil {
+		base = realBase
+	}
+
+	full := filepath.FromSlash(path)
+	if !filepath.IsAbs(full) {
+		full = filepath.Join(base, full)
+	}
+	full = filepath.Clean(full)
+	if !withinDir(base, full) {
+		return "", fmt.Errorf("%q is outside of the base directory %s", path, base)
+	}
+
+	// The path might also escape via a symbolic link, so we check again
+	// once those are resolved. A path that doesn't exist can't contain any
+	// symbolic links, so we'll let the caller report that instead.
+	if real, err := filepath.EvalSymlinks(full); err == nil {
+		if !withinDir(base, real) {
+			return "", fmt.Errorf("%q refers to a file outside of the base directory %s", path, base)
+		}
+		full = real
+	}
+	return full, nil
+}
+
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// fileFunc returns a function that returns the contents of a file, which
+// must be valid UTF-8.
+func fileFunc(resolve pathFunc) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "path",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			src, err := readFileArg(resolve, args[0], 0)
+			if err != nil {
+				return cty.UnknownVal(cty.String), err
+			}
+			if !utf8.Valid(src) {
+				return cty.UnknownVal(cty.String), function.NewArgErrorf(0, "contents of %q are not valid UTF-8; use filebase64 to read binary files", args[0].AsString())
+			}
+			return cty.StringVal(string(src)), nil
+		},
+	})
+}
+
+// fileBase64Func returns a function that returns the contents of a file
+// encoded as base64.
+func fileBase64Func(resolve pathFunc) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "path",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			src, err := readFileArg(resolve, args[0], 0)
+			if err != nil {
+				return cty.UnknownVal(cty.String), err
+			}
+			return cty.StringVal(base64.StdEncoding.EncodeToString(src)), nil
+		},
+	})
+}
+
+// fileExistsFunc returns a function that returns true if a regular file
+// exists at the given path.
+func fileExistsFunc(resolve pathFunc) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "path",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.Bool),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			path, err := resolve(args[0].AsString())
+			if err != nil {
+				return cty.UnknownVal(cty.Bool), function.NewArgError(0, err)
+			}
+			info, err := os.Stat(path)
+			if os.IsNotExist(err) {
+				return cty.False, nil
+			}
+			if err != nil {
+				return cty.UnknownVal(cty.Bool), function.NewArgError(0, err)
+			}
+			return cty.BoolVal(info.Mode().IsRegular()), nil
+		},
+	})
+}
+
+// fileSetFunc returns a function that returns the set of paths of regular
+// files matching a pattern, relative to the base directory and using
+// forward slashes as separators. Patterns use the syntax of filepath.Match,
+// applied to each segment of the path.
+func fileSetFunc(resolve pathFunc) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "pattern",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.Set(cty.String)),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			pattern := args[0].AsString()
+			base, err := resolve(".")
+			if err != nil {
+				return cty.UnknownVal(retType), function.NewArgError(0, err)
+			}
+			full := filepath.FromSlash(pattern)
+			if !filepath.IsAbs(full) {
+				full = filepath.Join(base, full)
+			}
+			matches, err := filepath.Glob(full)
+			if err != nil {
+				return cty.UnknownVal(retType), function.NewArgErrorf(0, "invalid pattern %q: %s", pattern, err)
+			}
+
+			var paths []string
+			for _, match := range matches {
+				path, err := resolve(match)
+				if err != nil {
+					// Files outside of the base directory are silently
+					// excluded, as if they didn't exist.
+					continue
+				}
+				if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+					continue
+				}
+				rel, err := filepath.Rel(base, filepath.Clean(match))
+				if err != nil {
+					continue
+				}
+				paths = append(paths, filepath.ToSlash(rel))
+			}
+			if len(paths) == 0 {
+				return cty.SetValEmpty(cty.String), nil
+			}
+			sort.Strings(paths)
+			vals := make([]cty.Value, len(paths))
+			for i, path := range paths {
+				vals[i] = cty.StringVal(path)
+			}
+			return cty.SetVal(vals), nil
+		},
+	})
+}
+
+// templateFileFunc returns a function that renders a file as a template,
+// using the given context extended with the given variables. The context
+// provides the functions available to the template, but not the symbols
+// of the table, so that a template uses only the values passed to it.
+func templateFileFunc(resolve pathFunc, ctx *hcl.EvalContext) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "path",
+				Type: cty.String,
+			},
+			{
+				Name: "vars",
+				Type: cty.DynamicPseudoType,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			ty := args[1].Type()
+			if !(ty.IsObjectType() || ty.IsMapType()) {
+				return cty.UnknownVal(cty.String), function.NewArgErrorf(1, "must be an object or a map of template variables")
+			}
+			if !args[1].IsWhollyKnown() {
+				return cty.UnknownVal(cty.String), nil
+			}
+			vars := valueAttrs(args[1])
+			for name := range vars {
+				if !hclsyntax.ValidIdentifier(name) {
+					return cty.UnknownVal(cty.String), function.NewArgErrorf(1, "invalid template variable name %q: must be a valid identifier", name)
+				}
+			}
+
+			src, err := readFileArg(resolve, args[0], 0)
+			if err != nil {
+				return cty.UnknownVal(cty.String), err
+			}
+			expr, diags := hclsyntax.ParseTemplate(src, args[0].AsString(), hcl.Pos{Line: 1, Column: 1})
+			if !diags.HasErrors() {
+				var rewriteDiags hcl.Diagnostics
+				expr, rewriteDiags = rewriteExpression(expr, src)
+				diags = append(diags, rewriteDiags...)
+			}
+			if diags.HasErrors() {
+				// Smuggle the diagnostics out via the error channel, as
+				// for user-defined functions.
+				return cty.UnknownVal(cty.String), diags
+			}
+
+			// The expressions given to can and try are evaluated in the
+			// template's own scope, so that they can't reach the real
+			// templatefile either.
+			tmplCtx := ctx.NewChild()
+			tmplCtx.Variables = vars
+			tmplScope := func(vars map[string]cty.Value) *hcl.EvalContext {
+				scope := tmplCtx.NewChild()
+				scope.Variables = vars
+				return scope
+			}
+			tmplCtx.Functions = map[string]function.Function{
+				"can":          canFunc(tmplScope),
+				"templatefile": noNestedTemplateFunc,
+				"try":          tryFunc(tmplScope),
+			}
+			val, diags := expr.Value(tmplCtx)
+			if diags.HasErrors() {
+				return cty.UnknownVal(cty.String), diags
+			}
+			// A template consisting only of a single interpolation produces
+			// the value of that interpolation directly.
+			val, err = convert.Convert(val, cty.String)
+			if err != nil {
+				return cty.UnknownVal(cty.String), fmt.Errorf("template produced an invalid result: %s", err)
+			}
+			return val, nil
+		},
+	})
+}
+
+// noNestedTemplateFunc replaces templatefile within templates, since a
+// template that renders itself would never terminate.
+var noNestedTemplateFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "path",
+			Type: cty.String,
+		},
+		{
+			Name: "vars",
+			Type: cty.DynamicPseudoType,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.UnknownVal(cty.String), fmt.Errorf("templatefile cannot be called from within a template")
+	},
+})
+
+func readFileArg(resolve pathFunc, val cty.Value, argIdx int) ([]byte, error) {
+	path, err := resolve(val.AsString())
+	if err != nil {
+		return nil, function.NewArgError(argIdx, err)
+	}
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, function.NewArgErrorf(argIdx, "no file exists at %q", val.AsString())
+		}
+		return nil, function.NewArgError(argIdx, err)
+	}
+	return src, nil
+}
+
+// fileHashFunc builds a function that hashes the contents of a file using
+// the given algorithm and then encodes the resulting digest as a string.
+func fileHashFunc(resolve pathFunc, newHash func() hash.Hash, encode func([]byte) string) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "path",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			src, err := readFileArg(resolve, args[0], 0)
+			if err != nil {
+				return cty.UnknownVal(cty.String), err
+			}
+			h := newHash()
+			h.Write(src)
+			return cty.StringVal(encode(h.Sum(nil))), nil
+		},
+	})
+}
+
+// dirFileSetFunc returns Terraform's variant of fileset, which takes the
+// directory to search separately from the pattern and returns paths relative
+// to that directory. Unlike fileSetFunc, a "**" segment in the pattern
+// matches any number of directories.
+func dirFileSetFunc(resolve pathFunc) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "path",
+				Type: cty.String,
+			},
+			{
+				Name: "pattern",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.Set(cty.String)),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			dir, err := resolve(args[0].AsString())
+			if err != nil {
+				return cty.UnknownVal(retType), function.NewArgError(0, err)
+			}
+			pattern := strings.Split(filepath.ToSlash(args[1].AsString()), "/")
+			for _, seg := range pattern {
+				if _, err := path.Match(seg, ""); err != nil {
+					return cty.UnknownVal(retType), function.NewArgErrorf(1, "invalid pattern %q: %s", args[1].AsString(), err)
+				}
+			}
+
+			var paths []cty.Value
+			err = filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+				if err != nil || !info.Mode().IsRegular() {
+					return nil
+				}
+				if _, err := resolve(file); err != nil {
+					return nil
+				}
+				rel, err := filepath.Rel(dir, file)
+				if err != nil {
+					return nil
+				}
+				rel = filepath.ToSlash(rel)
+				if matchSegments(pattern, strings.Split(rel, "/")) {
+					paths = append(paths, cty.StringVal(rel))
+				}
+				return nil
+			})
+			if err != nil {
+				return cty.UnknownVal(retType), function.NewArgError(0, err)
+			}
+			if len(paths) == 0 {
+				return cty.SetValEmpty(cty.String), nil
+			}
+			return cty.SetVal(paths), nil
+		},
+	})
+}
+
+// matchSegments returns true if the given path segments match the given
+// pattern segments, where a "**" pattern segment matches any number of path
+// segments and other segments are matched using path.Match.
+func matchSegments(pattern, segs []string) bool {
+	if len(pattern) == 0 {
+		return len(segs) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segs); i++ {
+			if matchSegments(pattern[1:], segs[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segs) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segs[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segs[1:])
+}
+
+// absPathFunc converts a path to an absolute path, relative to the current
+// working directory. Since it doesn't access the file, it isn't restricted
+// to the base directory.
+var absPathFunc = pathStringFunc(func(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	return filepath.ToSlash(abs), err
+})
+
+var dirnameFunc = pathStringFunc(func(p string) (string, error) {
+	return filepath.Dir(p), nil
+})
+
+var basenameFunc = pathStringFunc(func(p string) (string, error) {
+	return filepath.Base(p), nil
+})
+
+// pathStringFunc builds a function that transforms a path string.
+func pathStringFunc(f func(string) (string, error)) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "path",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			result, err := f(args[0].AsString())
+			if err != nil {
+				return cty.UnknownVal(cty.String), function.NewArgError(0, err)
+			}
+			return cty.StringVal(result), nil
+		},
+	})
+}
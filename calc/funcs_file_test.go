@@ -0,0 +1,37 @@
+package calc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func mustParse(t testing.TB, src string) Expression {
+	t.Helper()
+	expr, diags := ParseExpressionString(src, "test")
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	return expr
+}
+
+// TestTemplateFileNested checks that a template can't call templatefile,
+// including through the expressions given to can and try, which are
+// evaluated separately from the rest of the template.
+func TestTemplateFileNested(t *testing.T) {
+	dir := t.TempDir()
+	tmpl := `${try(templatefile("self.tmpl", {}), "tried")}-${can(templatefile("self.tmpl", {}))}`
+	if err := os.WriteFile(filepath.Join(dir, "self.tmpl"), []byte(tmpl), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	table := NewTable()
+	table.SetBaseDir(dir)
+	got, diags := table.Eval(mustParse(t, `templatefile("self.tmpl", {})`))
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	if got.AsString() != "tried-false" {
+		t.Errorf("wrong result %q, want \"tried-false\"", got.AsString())
+	}
+}
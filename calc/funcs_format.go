@@ -0,0 +1,169 @@
+package calc
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// The functions in this file make large numbers, and byte sizes in
+// particular, easier to read and write. They work with plain numbers,
+// independently of the quantities defined in quantity.go.
+
+var parseBytesFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "str",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		str := args[0].AsString()
+		if n, _, err := big.ParseFloat(strings.TrimSpace(str), 10, 512, big.ToNearestEven); err == nil {
+			// A plain number is already a number of bytes.
+			return cty.NumberVal(n), nil
+		}
+
+		q, err := ParseQuantity(str)
+		if err != nil {
+			return cty.UnknownVal(cty.Number), function.NewArgError(0, err)
+		}
+		q, err = q.Convert("B")
+		if err != nil {
+			return cty.UnknownVal(cty.Number), function.NewArgErrorf(0, "%q is not a size in bytes", str)
+		}
+		return cty.NumberVal(q.Amount()), nil
+	},
+})
+
+var formatBytesFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "num",
+			Type: cty.Number,
+		},
+	},
+	VarParam: &function.Parameter{
+		Name: "style",
+		Type: cty.String,
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		style := "iec"
+		switch {
+		case len(args) > 2:
+			return cty.UnknownVal(cty.String), function.NewArgErrorf(2, "too many arguments")
+		case len(args) == 2:
+			style = args[1].AsString()
+		}
+
+		var base float64
+		var prefixes []string
+		switch style {
+		case "si":
+			base, prefixes = 1000, []string{"kB", "MB", "GB", "TB", "PB", "EB"}
+		case "iec":
+			base, prefixes = 1024, []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+		default:
+			return cty.UnknownVal(cty.String), function.NewArgErrorf(1, "must be either \"si\" or \"iec\"")
+		}
+
+		n, _ := args[0].AsBigFloat().Float64()
+		return cty.StringVal(scaleNumber(n, base, "B", prefixes)), nil
+	},
+})
+
+var humanizeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "num",
+			Type: cty.Number,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		n, _ := args[0].AsBigFloat().Float64()
+		return cty.StringVal(scaleNumber(n, 1000, "", []string{"thousand", "million", "billion", "trillion", "quadrillion"})), nil
+	},
+})
+
+var thousandsFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "num",
+			Type: cty.Number,
+		},
+	},
+	VarParam: &function.Parameter{
+		Name: "sep",
+		Type: cty.String,
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		sep := ","
+		switch {
+		case len(args) > 2:
+			return cty.UnknownVal(cty.String), function.NewArgErrorf(2, "too many arguments")
+		case len(args) == 2:
+			sep = args[1].AsString()
+		}
+		return cty.StringVal(groupThousands(args[0].AsBigFloat(), sep)), nil
+	},
+})
+
+// scaleNumber writes the given number using the largest of the given
+// prefixes, each of which is the given base times larger than the previous,
+// that leaves a magnitude of at least one. At most two decimal places are
+// retained.
+func scaleNumber(n float64, base float64, unit string, prefixes []string) string {
+	scaled, suffix := n, unit
+	for _, prefix := range prefixes {
+		if scaled > -base && scaled < base {
+			break
+		}
+		scaled /= base
+		suffix = prefix
+	}
+	str := strconv.FormatFloat(scaled, 'f', 2, 64)
+	str = strings.TrimRight(strings.TrimRight(str, "0"), ".")
+	if suffix == "" {
+		return str
+	}
+	return str + " " + suffix
+}
+
+// groupThousands writes the given number in decimal with the given separator
+// between each group of three digits in its integer part.
+func groupThousands(n *big.Float, sep string) string {
+	var str string
+	if n.IsInt() {
+		str = n.Text('f', 0)
+	} else {
+		f, _ := n.Float64()
+		str = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	sign := ""
+	if strings.HasPrefix(str, "-") {
+		sign, str = "-", str[1:]
+	}
+	intPart, fracPart := str, ""
+	if dot := strings.IndexByte(str, '.'); dot != -1 {
+		intPart, fracPart = str[:dot], str[dot:]
+	}
+
+	var buf strings.Builder
+	buf.WriteString(sign)
+	for i, digit := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			buf.WriteString(sep)
+		}
+		buf.WriteRune(digit)
+	}
+	buf.WriteString(fracPart)
+	return buf.String()
+}
@@ -0,0 +1,112 @@
+package calc
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+var md5Func = hashFunc(md5.New, hex.EncodeToString)
+var sha1Func = hashFunc(sha1.New, hex.EncodeToString)
+var sha256Func = hashFunc(sha256.New, hex.EncodeToString)
+var sha512Func = hashFunc(sha512.New, hex.EncodeToString)
+var base64SHA256Func = hashFunc(sha256.New, base64.StdEncoding.EncodeToString)
+var base64SHA512Func = hashFunc(sha512.New, base64.StdEncoding.EncodeToString)
+
+// crc32Func produces the IEEE CRC-32 checksum of a string, written as eight
+// hexadecimal digits.
+var crc32Func = hashFunc(func() hash.Hash { return crc32.NewIEEE() }, hex.EncodeToString)
+
+var uuidV5Func = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "namespace",
+			Type: cty.String,
+		},
+		{
+			Name: "name",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		nsStr := args[0].AsString()
+		ns, ok := uuidNamespaces[nsStr]
+		if !ok {
+			var err error
+			ns, err = parseUUID(nsStr)
+			if err != nil {
+				return cty.UnknownVal(cty.String), function.NewArgErrorf(0, "must be \"dns\", \"url\", \"oid\", \"x500\" or a UUID: %s", err)
+			}
+		}
+
+		h := sha1.New()
+		h.Write(ns)
+		h.Write([]byte(args[1].AsString()))
+		uuid := h.Sum(nil)[:16]
+		uuid[6] = (uuid[6] & 0x0f) | 0x50 // version 5
+		uuid[8] = (uuid[8] & 0x3f) | 0x80 // RFC 4122 variant
+		return cty.StringVal(formatUUID(uuid)), nil
+	},
+})
+
+// hashFunc builds a function that hashes the bytes of a string using the
+// given algorithm and then encodes the resulting digest as a string.
+func hashFunc(newHash func() hash.Hash, encode func([]byte) string) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "str",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			h := newHash()
+			h.Write([]byte(args[0].AsString()))
+			return cty.StringVal(encode(h.Sum(nil))), nil
+		},
+	})
+}
+
+// uuidNamespaces are the well-known namespaces defined in RFC 4122, which
+// can be given by name to uuidv5.
+var uuidNamespaces = map[string][]byte{
+	"dns":  mustParseUUID("6ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+	"url":  mustParseUUID("6ba7b811-9dad-11d1-80b4-00c04fd430c8"),
+	"oid":  mustParseUUID("6ba7b812-9dad-11d1-80b4-00c04fd430c8"),
+	"x500": mustParseUUID("6ba7b814-9dad-11d1-80b4-00c04fd430c8"),
+}
+
+func parseUUID(s string) ([]byte, error) {
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return nil, fmt.Errorf("%q is not in the form xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx", s)
+	}
+	buf, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+	if err != nil {
+		return nil, fmt.Errorf("%q contains characters that are not hexadecimal digits", s)
+	}
+	return buf, nil
+}
+
+func mustParseUUID(s string) []byte {
+	buf, err := parseUUID(s)
+	if err != nil {
+		panic(err)
+	}
+	return buf
+}
+
+func formatUUID(buf []byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", buf[0:4], buf[4:6], buf[6:8], buf[8:10], buf[10:16])
+}
@@ -0,0 +1,193 @@
+package calc
+
+import (
+	"math/big"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// HCL's lexer has no syntax for hexadecimal, octal or binary literals, so
+// the functions in this file allow working with integers in other bases
+// and with the individual bits of integers.
+
+var parseIntFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "str",
+			Type: cty.String,
+		},
+		{
+			Name: "base",
+			Type: cty.Number,
+		},
+	},
+	Type: function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		base, err := baseArg(args[1], 1)
+		if err != nil {
+			return cty.UnknownVal(cty.Number), err
+		}
+
+		str := args[0].AsString()
+		num, ok := new(big.Int).SetString(str, base)
+		if !ok {
+			return cty.UnknownVal(cty.Number), function.NewArgErrorf(0, "cannot parse %q as a base %d integer", str, base)
+		}
+		return cty.NumberVal(new(big.Float).SetInt(num)), nil
+	},
+})
+
+var formatIntFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "num",
+			Type: cty.Number,
+		},
+		{
+			Name: "base",
+			Type: cty.Number,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		num, err := intArg(args[0], 0)
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+		base, err := baseArg(args[1], 1)
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+		return cty.StringVal(num.Text(base)), nil
+	},
+})
+
+var bitAndFunc = bitwiseFunc(func(a, b *big.Int) *big.Int {
+	return new(big.Int).And(a, b)
+})
+
+var bitOrFunc = bitwiseFunc(func(a, b *big.Int) *big.Int {
+	return new(big.Int).Or(a, b)
+})
+
+var bitXorFunc = bitwiseFunc(func(a, b *big.Int) *big.Int {
+	return new(big.Int).Xor(a, b)
+})
+
+var bitNotFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "num",
+			Type: cty.Number,
+		},
+	},
+	Type: function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		num, err := intArg(args[0], 0)
+		if err != nil {
+			return cty.UnknownVal(cty.Number), err
+		}
+		return cty.NumberVal(new(big.Float).SetInt(new(big.Int).Not(num))), nil
+	},
+})
+
+var shlFunc = shiftFunc(func(num *big.Int, n uint) *big.Int {
+	return new(big.Int).Lsh(num, n)
+})
+
+var shrFunc = shiftFunc(func(num *big.Int, n uint) *big.Int {
+	return new(big.Int).Rsh(num, n)
+})
+
+// bitwiseFunc builds a function that folds the given operation over one or
+// more integer arguments.
+func bitwiseFunc(op func(a, b *big.Int) *big.Int) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "num",
+				Type: cty.Number,
+			},
+		},
+		VarParam: &function.Parameter{
+			Name: "nums",
+			Type: cty.Number,
+		},
+		Type: function.StaticReturnType(cty.Number),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			result, err := intArg(args[0], 0)
+			if err != nil {
+				return cty.UnknownVal(cty.Number), err
+			}
+			for i, arg := range args[1:] {
+				num, err := intArg(arg, i+1)
+				if err != nil {
+					return cty.UnknownVal(cty.Number), err
+				}
+				result = op(result, num)
+			}
+			return cty.NumberVal(new(big.Float).SetInt(result)), nil
+		},
+	})
+}
+
+// shiftFunc builds a function that shifts its first argument by the number
+// of bits given in its second argument.
+func shiftFunc(op func(num *big.Int, n uint) *big.Int) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "num",
+				Type: cty.Number,
+			},
+			{
+				Name: "bits",
+				Type: cty.Number,
+			},
+		},
+		Type: function.StaticReturnType(cty.Number),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			num, err := intArg(args[0], 0)
+			if err != nil {
+				return cty.UnknownVal(cty.Number), err
+			}
+			bits, err := intArg(args[1], 1)
+			if err != nil {
+				return cty.UnknownVal(cty.Number), err
+			}
+			if bits.Sign() < 0 || !bits.IsUint64() || bits.Uint64() > maxShiftBits {
+				return cty.UnknownVal(cty.Number), function.NewArgErrorf(1, "shift count must be between 0 and %d", maxShiftBits)
+			}
+			return cty.NumberVal(new(big.Float).SetInt(op(num, uint(bits.Uint64())))), nil
+		},
+	})
+}
+
+// maxShiftBits is the largest shift count accepted by shl and shr, which
+// protects against accidentally allocating an enormous integer.
+const maxShiftBits = 4096
+
+// intArg returns the given number value as an integer, or an argument
+// error if it has a fractional part.
+func intArg(val cty.Value, argIdx int) (*big.Int, error) {
+	bf := val.AsBigFloat()
+	if !bf.IsInt() {
+		return nil, function.NewArgErrorf(argIdx, "must be a whole number")
+	}
+	num, _ := bf.Int(nil)
+	return num, nil
+}
+
+// baseArg returns the given number value as a base suitable for use with
+// the conversion methods of big.Int.
+func baseArg(val cty.Value, argIdx int) (int, error) {
+	num, err := intArg(val, argIdx)
+	if err != nil {
+		return 0, err
+	}
+	if !num.IsInt64() || num.Int64() < 2 || num.Int64() > big.MaxBase {
+		return 0, function.NewArgErrorf(argIdx, "base must be between 2 and %d", big.MaxBase)
+	}
+	return int(num.Int64()), nil
+}
@@ -0,0 +1,352 @@
+package calc
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// The functions in this file follow the behavior of the functions with the
+// same names in Terraform, and so prefixes are always given in CIDR notation.
+// Both IPv4 and IPv6 are supported except where noted.
+
+var cidrSubnetFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "prefix",
+			Type: cty.String,
+		},
+		{
+			Name: "newbits",
+			Type: cty.Number,
+		},
+		{
+			Name: "netnum",
+			Type: cty.Number,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		base, err := parsePrefix(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), function.NewArgError(0, err)
+		}
+		newBits, err := prefixBitsArg(args[1], 1, base.Bits-base.Len)
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+		netNum, err := intArg(args[2], 2)
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+		if netNum.Sign() < 0 || netNum.BitLen() > newBits {
+			return cty.UnknownVal(cty.String), function.NewArgErrorf(2, "must be between 0 and %s to fit in %d new bits", maxForBits(newBits), newBits)
+		}
+
+		subnet := ipPrefix{
+			Addr: new(big.Int).Or(base.Addr, new(big.Int).Lsh(netNum, uint(base.Bits-base.Len-newBits))),
+			Len:  base.Len + newBits,
+			Bits: base.Bits,
+		}
+		return cty.StringVal(subnet.String()), nil
+	},
+})
+
+var cidrSubnetsFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "prefix",
+			Type: cty.String,
+		},
+	},
+	VarParam: &function.Parameter{
+		Name: "newbits",
+		Type: cty.Number,
+	},
+	Type: function.StaticReturnType(cty.List(cty.String)),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		base, err := parsePrefix(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(retType), function.NewArgError(0, err)
+		}
+		if len(args) == 1 {
+			return cty.ListValEmpty(cty.String), nil
+		}
+
+		// Each subnet is allocated immediately after the previous one,
+		// skipping forward as necessary to align it to its own size.
+		next := new(big.Int).Set(base.Addr)
+		end := base.Last()
+		ret := make([]cty.Value, 0, len(args)-1)
+		for i, arg := range args[1:] {
+			newBits, err := prefixBitsArg(arg, i+1, base.Bits-base.Len)
+			if err != nil {
+				return cty.UnknownVal(retType), err
+			}
+			subnet := ipPrefix{
+				Addr: new(big.Int).Set(next),
+				Len:  base.Len + newBits,
+				Bits: base.Bits,
+			}
+			if subnet.Addr.Cmp(subnet.Network().Addr) != 0 {
+				subnet.Addr = new(big.Int).Add(subnet.Network().Addr, subnet.Size())
+			}
+			last := subnet.Last()
+			if last.Cmp(end) > 0 {
+				return cty.UnknownVal(retType), function.NewArgErrorf(i+1, "not enough remaining address space in %s for a subnet with a prefix of %d bits", base, subnet.Len)
+			}
+			ret = append(ret, cty.StringVal(subnet.String()))
+			next = last.Add(last, big.NewInt(1))
+		}
+		return cty.ListVal(ret), nil
+	},
+})
+
+var cidrHostFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "prefix",
+			Type: cty.String,
+		},
+		{
+			Name: "hostnum",
+			Type: cty.Number,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		base, err := parsePrefix(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), function.NewArgError(0, err)
+		}
+		hostNum, err := intArg(args[1], 1)
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+
+		// Negative host numbers count backwards from the end of the range,
+		// so -1 is the last address.
+		var addr *big.Int
+		if hostNum.Sign() < 0 {
+			addr = new(big.Int).Add(base.Last(), hostNum)
+			addr.Add(addr, big.NewInt(1))
+		} else {
+			addr = new(big.Int).Add(base.Addr, hostNum)
+		}
+		if addr.Cmp(base.Addr) < 0 || addr.Cmp(base.Last()) > 0 {
+			return cty.UnknownVal(cty.String), function.NewArgErrorf(1, "prefix %s has only %s addresses", base, base.Size())
+		}
+		return cty.StringVal(intToIP(addr, base.Bits).String()), nil
+	},
+})
+
+var cidrNetmaskFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "prefix",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		base, err := parsePrefix(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), function.NewArgError(0, err)
+		}
+		if base.Bits != 32 {
+			return cty.UnknownVal(cty.String), function.NewArgErrorf(0, "only IPv4 prefixes have a netmask")
+		}
+		return cty.StringVal(net.IP(net.CIDRMask(base.Len, base.Bits)).String()), nil
+	},
+})
+
+var cidrContainsFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "prefix",
+			Type: cty.String,
+		},
+		{
+			Name: "addr",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.Bool),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		base, err := parsePrefix(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.Bool), function.NewArgError(0, err)
+		}
+		other, err := parseAddrOrPrefix(args[1].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.Bool), function.NewArgError(1, err)
+		}
+		if other.Bits != base.Bits {
+			return cty.UnknownVal(cty.Bool), function.NewArgErrorf(1, "cannot compare an IPv%d address with an IPv%d prefix", other.Version(), base.Version())
+		}
+
+		// The second argument may itself be a prefix, in which case all of
+		// its addresses must be within the first.
+		network := other.Network()
+		contained := other.Len >= base.Len && network.Addr.Cmp(base.Addr) >= 0 && network.Last().Cmp(base.Last()) <= 0
+		return cty.BoolVal(contained), nil
+	},
+})
+
+var ipInfoFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "addr",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(ipInfoType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		addr, err := parseAddrOrPrefix(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(ipInfoType), function.NewArgError(0, err)
+		}
+		network := addr.Network()
+		return cty.ObjectVal(map[string]cty.Value{
+			"version":       cty.NumberIntVal(int64(addr.Version())),
+			"address":       cty.StringVal(intToIP(addr.Addr, addr.Bits).String()),
+			"network":       cty.StringVal(network.String()),
+			"broadcast":     cty.StringVal(intToIP(network.Last(), addr.Bits).String()),
+			"prefix_length": cty.NumberIntVal(int64(addr.Len)),
+		}), nil
+	},
+})
+
+var ipInfoType = cty.Object(map[string]cty.Type{
+	"version":       cty.Number,
+	"address":       cty.String,
+	"network":       cty.String,
+	"broadcast":     cty.String,
+	"prefix_length": cty.Number,
+})
+
+// ipPrefix is an address and a prefix length, with the address represented
+// as an integer to make it easier to do arithmetic with.
+type ipPrefix struct {
+	Addr *big.Int
+	Len  int
+	Bits int
+}
+
+// parsePrefix parses a string in CIDR notation, returning its network
+// prefix. Any bits of the address after the prefix are discarded.
+func parsePrefix(s string) (ipPrefix, error) {
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		return ipPrefix{}, fmt.Errorf("invalid CIDR prefix %q", s)
+	}
+	ones, bits := ipNet.Mask.Size()
+	return ipPrefix{
+		Addr: ipToInt(ipNet.IP),
+		Len:  ones,
+		Bits: bits,
+	}, nil
+}
+
+// parseAddrOrPrefix parses either a single address or an address with a
+// prefix length in CIDR notation, retaining all of the bits of the address.
+// A single address is treated as a prefix covering only that address.
+func parseAddrOrPrefix(s string) (ipPrefix, error) {
+	if strings.Contains(s, "/") {
+		ip, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return ipPrefix{}, fmt.Errorf("invalid CIDR address %q", s)
+		}
+		ones, bits := ipNet.Mask.Size()
+		if v4 := ip.To4(); v4 != nil && bits == 32 {
+			ip = v4
+		}
+		return ipPrefix{
+			Addr: ipToInt(ip),
+			Len:  ones,
+			Bits: bits,
+		}, nil
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return ipPrefix{}, fmt.Errorf("invalid IP address %q", s)
+	}
+	if v4 := ip.To4(); v4 != nil && !strings.Contains(s, ":") {
+		ip = v4
+	}
+	return ipPrefix{
+		Addr: ipToInt(ip),
+		Len:  len(ip) * 8,
+		Bits: len(ip) * 8,
+	}, nil
+}
+
+func (p ipPrefix) Version() int {
+	if p.Bits == 32 {
+		return 4
+	}
+	return 6
+}
+
+// Size returns the number of addresses in the prefix.
+func (p ipPrefix) Size() *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(p.Bits-p.Len))
+}
+
+// Network returns the prefix with all of the host bits of its address
+// set to zero.
+func (p ipPrefix) Network() ipPrefix {
+	hostMask := new(big.Int).Sub(p.Size(), big.NewInt(1))
+	return ipPrefix{
+		Addr: new(big.Int).AndNot(p.Addr, hostMask),
+		Len:  p.Len,
+		Bits: p.Bits,
+	}
+}
+
+// Last returns the final address in the prefix, which for IPv4 is the
+// broadcast address.
+func (p ipPrefix) Last() *big.Int {
+	last := new(big.Int).Add(p.Network().Addr, p.Size())
+	return last.Sub(last, big.NewInt(1))
+}
+
+func (p ipPrefix) String() string {
+	return fmt.Sprintf("%s/%d", intToIP(p.Addr, p.Bits), p.Len)
+}
+
+func ipToInt(ip net.IP) *big.Int {
+	return new(big.Int).SetBytes(ip)
+}
+
+func intToIP(n *big.Int, bits int) net.IP {
+	buf := n.Bytes()
+	ip := make(net.IP, bits/8)
+	copy(ip[len(ip)-len(buf):], buf)
+	return ip
+}
+
+// prefixBitsArg returns the given number of additional prefix bits, which
+// must not exceed the given number of available bits.
+func prefixBitsArg(val cty.Value, argIdx int, avail int) (int, error) {
+	n, err := intArg(val, argIdx)
+	if err != nil {
+		return 0, err
+	}
+	if n.Sign() < 0 || !n.IsInt64() || n.Int64() > int64(avail) {
+		return 0, function.NewArgErrorf(argIdx, "must be between 0 and %d for this prefix", avail)
+	}
+	return int(n.Int64()), nil
+}
+
+// maxForBits returns the largest unsigned integer that can be represented
+// in the given number of bits.
+func maxForBits(bits int) *big.Int {
+	max := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	return max.Sub(max, big.NewInt(1))
+}
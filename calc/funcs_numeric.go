@@ -0,0 +1,104 @@
+package calc
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// The functions in this file are the numeric functions of Terraform, with
+// the same names and behavior.
+
+var ceilFunc = roundingFunc(true)
+var floorFunc = roundingFunc(false)
+
+// roundingFunc builds a function that rounds a number to a whole number,
+// either up towards positive infinity or down towards negative infinity.
+func roundingFunc(up bool) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "num",
+				Type: cty.Number,
+			},
+		},
+		Type: function.StaticReturnType(cty.Number),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			bf := args[0].AsBigFloat()
+			if bf.IsInf() || bf.IsInt() {
+				return args[0], nil
+			}
+			i, acc := bf.Int(nil)
+			switch {
+			case up && acc == big.Below:
+				i.Add(i, big.NewInt(1))
+			case !up && acc == big.Above:
+				i.Sub(i, big.NewInt(1))
+			}
+			return cty.NumberVal(new(big.Float).SetInt(i)), nil
+		},
+	})
+}
+
+var logFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "num",
+			Type: cty.Number,
+		},
+		{
+			Name: "base",
+			Type: cty.Number,
+		},
+	},
+	Type: function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		num, _ := args[0].AsBigFloat().Float64()
+		base, _ := args[1].AsBigFloat().Float64()
+		return floatResult(math.Log(num) / math.Log(base))
+	},
+})
+
+var powFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "num",
+			Type: cty.Number,
+		},
+		{
+			Name: "power",
+			Type: cty.Number,
+		},
+	},
+	Type: function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		num, _ := args[0].AsBigFloat().Float64()
+		power, _ := args[1].AsBigFloat().Float64()
+		return floatResult(math.Pow(num, power))
+	},
+})
+
+var signumFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "num",
+			Type: cty.Number,
+		},
+	},
+	Type: function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.NumberIntVal(int64(args[0].AsBigFloat().Sign())), nil
+	},
+})
+
+// floatResult returns the given result of a floating point calculation as
+// a number, or an error if it isn't a number at all.
+func floatResult(f float64) (cty.Value, error) {
+	if math.IsNaN(f) {
+		return cty.UnknownVal(cty.Number), fmt.Errorf("the result is not a real number")
+	}
+	return cty.NumberFloatVal(f), nil
+}
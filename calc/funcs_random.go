@@ -0,0 +1,200 @@
+package calc
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"math/rand"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// The functions in this file produce pseudo-random results, but since the
+// table re-evaluates expressions each time a value is needed, they must
+// return the same result each time they are evaluated or else the values
+// in the table would change on every evaluation.
+//
+// To achieve that, calls to these functions are rewritten when parsed (see
+// rewrite.go) to pass two additional leading arguments: a string that
+// identifies the call site, including the source code of the expression it
+// belongs to, and an object containing the values of any local variables
+// from enclosing for expressions. The generator for each call is seeded
+// from those along with the table's seed, so the result is stable until the
+// seed or the definition changes, while still varying between iterations
+// of a for expression.
+
+// randSource produces the generator for a particular call to one of the
+// random functions, given its call site and local variables.
+type randSource func(site string, locals cty.Value) *rand.Rand
+
+// seededRand returns a generator whose sequence is determined entirely by
+// the given seed, call site and local variables.
+func seededRand(seed int64, site string, locals cty.Value) *rand.Rand {
+	h := sha256.New()
+	binary.Write(h, binary.BigEndian, seed)
+	h.Write([]byte(site))
+	h.Write([]byte{0})
+	if buf, err := ctyjson.Marshal(locals, locals.Type()); err == nil {
+		h.Write(buf)
+	} else {
+		fmt.Fprintf(h, "%#v", locals)
+	}
+	sum := h.Sum(nil)
+	return rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(sum))))
+}
+
+// randomParams returns the given parameters preceded by the hidden
+// parameters that are added to each call by the rewriting step.
+func randomParams(params ...function.Parameter) []function.Parameter {
+	return append([]function.Parameter{
+		{
+			Name: "site",
+			Type: cty.String,
+		},
+		{
+			Name: "locals",
+			Type: cty.DynamicPseudoType,
+		},
+	}, params...)
+}
+
+func randomFunc(source randSource) function.Function {
+	return function.New(&function.Spec{
+		Params: randomParams(
+			function.Parameter{
+				Name: "min",
+				Type: cty.Number,
+			},
+			function.Parameter{
+				Name: "max",
+				Type: cty.Number,
+			},
+		),
+		Type: function.StaticReturnType(cty.Number),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			min, err := intArg(args[2], 2)
+			if err != nil {
+				return cty.UnknownVal(cty.Number), err
+			}
+			max, err := intArg(args[3], 3)
+			if err != nil {
+				return cty.UnknownVal(cty.Number), err
+			}
+			if max.Cmp(min) < 0 {
+				return cty.UnknownVal(cty.Number), function.NewArgErrorf(3, "must not be less than min")
+			}
+
+			r := source(args[0].AsString(), args[1])
+			span := new(big.Int).Sub(max, min)
+			span.Add(span, big.NewInt(1))
+			n := new(big.Int).Rand(r, span)
+			n.Add(n, min)
+			return cty.NumberVal(new(big.Float).SetInt(n)), nil
+		},
+	})
+}
+
+func shuffleFunc(source randSource) function.Function {
+	return function.New(&function.Spec{
+		Params: randomParams(
+			function.Parameter{
+				Name: "list",
+				Type: cty.DynamicPseudoType,
+			},
+		),
+		Type: func(args []cty.Value) (cty.Type, error) {
+			ty := args[2].Type()
+			if !(ty.IsListType() || ty.IsTupleType()) {
+				return cty.DynamicPseudoType, function.NewArgErrorf(2, "must be a list or a tuple")
+			}
+			if ty.IsTupleType() {
+				// The element types of a tuple move along with the elements,
+				// so we can't know the result type until we've shuffled.
+				return cty.DynamicPseudoType, nil
+			}
+			return ty, nil
+		},
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			elems := args[2].AsValueSlice()
+			r := source(args[0].AsString(), args[1])
+			r.Shuffle(len(elems), func(i, j int) {
+				elems[i], elems[j] = elems[j], elems[i]
+			})
+			return sequenceVal(args[2].Type(), elems), nil
+		},
+	})
+}
+
+func sampleFunc(source randSource) function.Function {
+	return function.New(&function.Spec{
+		Params: randomParams(
+			function.Parameter{
+				Name: "list",
+				Type: cty.DynamicPseudoType,
+			},
+			function.Parameter{
+				Name: "n",
+				Type: cty.Number,
+			},
+		),
+		Type: func(args []cty.Value) (cty.Type, error) {
+			ty := args[2].Type()
+			if !(ty.IsListType() || ty.IsTupleType()) {
+				return cty.DynamicPseudoType, function.NewArgErrorf(2, "must be a list or a tuple")
+			}
+			if ty.IsTupleType() {
+				return cty.DynamicPseudoType, nil
+			}
+			return ty, nil
+		},
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			elems := args[2].AsValueSlice()
+			n, err := intArg(args[3], 3)
+			if err != nil {
+				return cty.DynamicVal, err
+			}
+			if n.Sign() < 0 || n.Cmp(big.NewInt(int64(len(elems)))) > 0 {
+				return cty.DynamicVal, function.NewArgErrorf(3, "must be between 0 and the length of the list, %d", len(elems))
+			}
+
+			// We choose the sample by shuffling a copy and taking its
+			// prefix, so that the chosen elements are all distinct.
+			r := source(args[0].AsString(), args[1])
+			r.Shuffle(len(elems), func(i, j int) {
+				elems[i], elems[j] = elems[j], elems[i]
+			})
+			return sequenceVal(args[2].Type(), elems[:n.Int64()]), nil
+		},
+	})
+}
+
+func uuidFunc(source randSource) function.Function {
+	return function.New(&function.Spec{
+		Params: randomParams(),
+		Type:   function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			r := source(args[0].AsString(), args[1])
+			buf := make([]byte, 16)
+			r.Read(buf)
+			buf[6] = (buf[6] & 0x0f) | 0x40 // version 4
+			buf[8] = (buf[8] & 0x3f) | 0x80 // RFC 4122 variant
+			return cty.StringVal(formatUUID(buf)), nil
+		},
+	})
+}
+
+// sequenceVal returns a value of the same kind as the given list or tuple
+// type with the given elements.
+func sequenceVal(ty cty.Type, elems []cty.Value) cty.Value {
+	switch {
+	case ty.IsTupleType():
+		return cty.TupleVal(elems)
+	case len(elems) == 0:
+		return cty.ListValEmpty(ty.ElementType())
+	default:
+		return cty.ListVal(elems)
+	}
+}
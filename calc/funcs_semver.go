@@ -0,0 +1,148 @@
+package calc
+
+import (
+	"sort"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// Version strings and constraints are interpreted in the same way as for
+// Terraform providers and modules, so constraints may use the operators
+// =, !=, >, >=, <, <= and ~>, with multiple constraints separated by commas.
+
+var semverFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "version",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(semverType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		v, err := versionArg(args[0], 0)
+		if err != nil {
+			return cty.UnknownVal(semverType), err
+		}
+		segs := v.Segments64()
+		return cty.ObjectVal(map[string]cty.Value{
+			"major":      cty.NumberIntVal(segs[0]),
+			"minor":      cty.NumberIntVal(segs[1]),
+			"patch":      cty.NumberIntVal(segs[2]),
+			"prerelease": cty.StringVal(v.Prerelease()),
+			"metadata":   cty.StringVal(v.Metadata()),
+		}), nil
+	},
+})
+
+var semverType = cty.Object(map[string]cty.Type{
+	"major":      cty.Number,
+	"minor":      cty.Number,
+	"patch":      cty.Number,
+	"prerelease": cty.String,
+	"metadata":   cty.String,
+})
+
+var semverCmpFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "a",
+			Type: cty.String,
+		},
+		{
+			Name: "b",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		a, err := versionArg(args[0], 0)
+		if err != nil {
+			return cty.UnknownVal(cty.Number), err
+		}
+		b, err := versionArg(args[1], 1)
+		if err != nil {
+			return cty.UnknownVal(cty.Number), err
+		}
+		return cty.NumberIntVal(int64(a.Compare(b))), nil
+	},
+})
+
+var semverMatchFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "version",
+			Type: cty.String,
+		},
+		{
+			Name: "constraint",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.Bool),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		v, err := versionArg(args[0], 0)
+		if err != nil {
+			return cty.UnknownVal(cty.Bool), err
+		}
+		constraints, err := version.NewConstraint(args[1].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.Bool), function.NewArgError(1, err)
+		}
+		return cty.BoolVal(constraints.Check(v)), nil
+	},
+})
+
+var semverSortFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "versions",
+			Type: cty.List(cty.String),
+		},
+	},
+	Type: function.StaticReturnType(cty.List(cty.String)),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		list := args[0]
+		if list.LengthInt() == 0 {
+			return list, nil
+		}
+		if !list.IsWhollyKnown() {
+			return cty.UnknownVal(retType), nil
+		}
+
+		type entry struct {
+			str string
+			v   *version.Version
+		}
+		entries := make([]entry, 0, list.LengthInt())
+		for it := list.ElementIterator(); it.Next(); {
+			_, ev := it.Element()
+			if ev.IsNull() {
+				return cty.UnknownVal(retType), function.NewArgErrorf(0, "must not contain null values")
+			}
+			v, err := version.NewVersion(ev.AsString())
+			if err != nil {
+				return cty.UnknownVal(retType), function.NewArgErrorf(0, "invalid version %q: %s", ev.AsString(), err)
+			}
+			entries = append(entries, entry{ev.AsString(), v})
+		}
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].v.LessThan(entries[j].v)
+		})
+
+		ret := make([]cty.Value, len(entries))
+		for i, e := range entries {
+			ret[i] = cty.StringVal(e.str)
+		}
+		return cty.ListVal(ret), nil
+	},
+})
+
+func versionArg(val cty.Value, argIdx int) (*version.Version, error) {
+	v, err := version.NewVersion(val.AsString())
+	if err != nil {
+		return nil, function.NewArgError(argIdx, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,323 @@
+package calc
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// The functions in this file are the string functions of Terraform, with
+// the same names and behavior.
+
+var joinFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "separator",
+			Type: cty.String,
+		},
+	},
+	VarParam: &function.Parameter{
+		Name: "lists",
+		Type: cty.List(cty.String),
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		if len(args) < 2 {
+			return cty.UnknownVal(cty.String), fmt.Errorf("at least one list is required")
+		}
+		var items []string
+		for i, list := range args[1:] {
+			if !list.IsWhollyKnown() {
+				return cty.UnknownVal(cty.String), nil
+			}
+			for it := list.ElementIterator(); it.Next(); {
+				_, ev := it.Element()
+				if ev.IsNull() {
+					return cty.UnknownVal(cty.String), function.NewArgErrorf(i+1, "must not contain null values")
+				}
+				items = append(items, ev.AsString())
+			}
+		}
+		return cty.StringVal(strings.Join(items, args[0].AsString())), nil
+	},
+})
+
+var splitFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "separator",
+			Type: cty.String,
+		},
+		{
+			Name: "str",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.List(cty.String)),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		parts := strings.Split(args[1].AsString(), args[0].AsString())
+		vals := make([]cty.Value, len(parts))
+		for i, part := range parts {
+			vals[i] = cty.StringVal(part)
+		}
+		return cty.ListVal(vals), nil
+	},
+})
+
+// replaceFunc replaces each occurrence of a substring, or of a regular
+// expression if the substring is given between slashes.
+var replaceFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "str",
+			Type: cty.String,
+		},
+		{
+			Name: "substr",
+			Type: cty.String,
+		},
+		{
+			Name: "replace",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		str := args[0].AsString()
+		substr := args[1].AsString()
+		replace := args[2].AsString()
+
+		if len(substr) > 1 && substr[0] == '/' && substr[len(substr)-1] == '/' {
+			re, err := regexp.Compile(substr[1 : len(substr)-1])
+			if err != nil {
+				return cty.UnknownVal(cty.String), function.NewArgError(1, err)
+			}
+			return cty.StringVal(re.ReplaceAllString(str, replace)), nil
+		}
+		return cty.StringVal(strings.Replace(str, substr, replace, -1)), nil
+	},
+})
+
+var regexFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "pattern",
+			Type: cty.String,
+		},
+		{
+			Name: "str",
+			Type: cty.String,
+		},
+	},
+	Type: func(args []cty.Value) (cty.Type, error) {
+		if !args[0].IsKnown() {
+			return cty.DynamicPseudoType, nil
+		}
+		re, err := regexp.Compile(args[0].AsString())
+		if err != nil {
+			return cty.DynamicPseudoType, function.NewArgError(0, err)
+		}
+		return regexMatchType(re)
+	},
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		re := regexp.MustCompile(args[0].AsString())
+		str := args[1].AsString()
+		match := re.FindStringSubmatch(str)
+		if match == nil {
+			return cty.UnknownVal(retType), function.NewArgErrorf(1, "pattern did not match any part of the given string")
+		}
+		return regexMatchVal(re, match), nil
+	},
+})
+
+var regexAllFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "pattern",
+			Type: cty.String,
+		},
+		{
+			Name: "str",
+			Type: cty.String,
+		},
+	},
+	Type: func(args []cty.Value) (cty.Type, error) {
+		if !args[0].IsKnown() {
+			return cty.List(cty.DynamicPseudoType), nil
+		}
+		re, err := regexp.Compile(args[0].AsString())
+		if err != nil {
+			return cty.DynamicPseudoType, function.NewArgError(0, err)
+		}
+		ty, err := regexMatchType(re)
+		if err != nil {
+			return cty.DynamicPseudoType, err
+		}
+		return cty.List(ty), nil
+	},
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		re := regexp.MustCompile(args[0].AsString())
+		matches := re.FindAllStringSubmatch(args[1].AsString(), -1)
+		if len(matches) == 0 {
+			return cty.ListValEmpty(retType.ElementType()), nil
+		}
+		vals := make([]cty.Value, len(matches))
+		for i, match := range matches {
+			vals[i] = regexMatchVal(re, match)
+		}
+		return cty.ListVal(vals), nil
+	},
+})
+
+// regexMatchType returns the type of the value that describes a match of
+// the given pattern: a string if it has no capture groups, a list of
+// strings if its groups are all unnamed, or otherwise an object with an
+// attribute for each named group.
+func regexMatchType(re *regexp.Regexp) (cty.Type, error) {
+	names := re.SubexpNames()
+	switch {
+	case len(names) == 1:
+		return cty.String, nil
+	case names[1] == "":
+		for _, name := range names[1:] {
+			if name != "" {
+				return cty.DynamicPseudoType, function.NewArgErrorf(0, "must not mix named and unnamed capture groups")
+			}
+		}
+		return cty.List(cty.String), nil
+	default:
+		atys := make(map[string]cty.Type, len(names)-1)
+		for _, name := range names[1:] {
+			if name == "" {
+				return cty.DynamicPseudoType, function.NewArgErrorf(0, "must not mix named and unnamed capture groups")
+			}
+			atys[name] = cty.String
+		}
+		return cty.Object(atys), nil
+	}
+}
+
+func regexMatchVal(re *regexp.Regexp, match []string) cty.Value {
+	names := re.SubexpNames()
+	switch {
+	case len(names) == 1:
+		return cty.StringVal(match[0])
+	case names[1] == "":
+		vals := make([]cty.Value, len(match)-1)
+		for i, group := range match[1:] {
+			vals[i] = cty.StringVal(group)
+		}
+		return cty.ListVal(vals)
+	default:
+		attrs := make(map[string]cty.Value, len(names)-1)
+		for i, name := range names[1:] {
+			attrs[name] = cty.StringVal(match[i+1])
+		}
+		return cty.ObjectVal(attrs)
+	}
+}
+
+var titleFunc = stringFunc(strings.Title)
+var trimSpaceFunc = stringFunc(strings.TrimSpace)
+
+// chompFunc removes newline characters from the end of a string.
+var chompFunc = stringFunc(func(str string) string {
+	return strings.TrimRight(str, "\r\n")
+})
+
+var trimFunc = stringPairFunc("cutset", strings.Trim)
+var trimPrefixFunc = stringPairFunc("prefix", strings.TrimPrefix)
+var trimSuffixFunc = stringPairFunc("suffix", strings.TrimSuffix)
+
+var startsWithFunc = stringTestFunc("prefix", strings.HasPrefix)
+var endsWithFunc = stringTestFunc("suffix", strings.HasSuffix)
+var strContainsFunc = stringTestFunc("substr", strings.Contains)
+
+// indentFunc adds the given number of spaces to the start of every line of
+// a string except the first, for use in templates where the first line is
+// already indented.
+var indentFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "spaces",
+			Type: cty.Number,
+		},
+		{
+			Name: "str",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		n, err := intArg(args[0], 0)
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+		if n.Sign() < 0 || n.BitLen() > 16 {
+			return cty.UnknownVal(cty.String), function.NewArgErrorf(0, "must be between 0 and 65535")
+		}
+		pad := strings.Repeat(" ", int(n.Int64()))
+		return cty.StringVal(strings.Replace(args[1].AsString(), "\n", "\n"+pad, -1)), nil
+	},
+})
+
+// stringFunc builds a function that transforms a single string.
+func stringFunc(f func(string) string) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "str",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return cty.StringVal(f(args[0].AsString())), nil
+		},
+	})
+}
+
+// stringPairFunc builds a function that transforms a string using a second
+// string with the given parameter name.
+func stringPairFunc(name string, f func(string, string) string) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "str",
+				Type: cty.String,
+			},
+			{
+				Name: name,
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return cty.StringVal(f(args[0].AsString(), args[1].AsString())), nil
+		},
+	})
+}
+
+// stringTestFunc builds a function that tests a string against a second
+// string with the given parameter name.
+func stringTestFunc(name string, f func(string, string) bool) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "str",
+				Type: cty.String,
+			},
+			{
+				Name: name,
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.Bool),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return cty.BoolVal(f(args[0].AsString(), args[1].AsString())), nil
+		},
+	})
+}
@@ -0,0 +1,281 @@
+package calc
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// Timestamps are always represented as strings in RFC 3339 format, as in
+// Terraform, and durations are given in Go's duration syntax, like "1h30m".
+
+// timestampFunc returns a function that returns the current time as given
+// by the given clock, in UTC.
+func timestampFunc(now func() time.Time) function.Function {
+	return function.New(&function.Spec{
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return cty.StringVal(now().UTC().Format(time.RFC3339)), nil
+		},
+	})
+}
+
+var timeAddFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "timestamp",
+			Type: cty.String,
+		},
+		{
+			Name: "duration",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		ts, err := timestampArg(args[0], 0)
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+		d, err := time.ParseDuration(args[1].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), function.NewArgError(1, err)
+		}
+		return cty.StringVal(ts.Add(d).Format(time.RFC3339)), nil
+	},
+})
+
+var timeCmpFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "a",
+			Type: cty.String,
+		},
+		{
+			Name: "b",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		a, err := timestampArg(args[0], 0)
+		if err != nil {
+			return cty.UnknownVal(cty.Number), err
+		}
+		b, err := timestampArg(args[1], 1)
+		if err != nil {
+			return cty.UnknownVal(cty.Number), err
+		}
+		switch {
+		case a.Before(b):
+			return cty.NumberIntVal(-1), nil
+		case a.After(b):
+			return cty.NumberIntVal(1), nil
+		default:
+			return cty.NumberIntVal(0), nil
+		}
+	},
+})
+
+var timeZoneFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "timestamp",
+			Type: cty.String,
+		},
+		{
+			Name: "zone",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		ts, err := timestampArg(args[0], 0)
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+		loc, err := time.LoadLocation(args[1].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), function.NewArgErrorf(1, "unknown time zone %q", args[1].AsString())
+		}
+		return cty.StringVal(ts.In(loc).Format(time.RFC3339)), nil
+	},
+})
+
+var parseDurationFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "duration",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		d, err := time.ParseDuration(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.Number), function.NewArgError(0, err)
+		}
+		return cty.NumberFloatVal(d.Seconds()), nil
+	},
+})
+
+var formatDurationFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "seconds",
+			Type: cty.Number,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		secs := args[0].AsBigFloat()
+		ns, acc := new(big.Float).Mul(secs, big.NewFloat(float64(time.Second))).Int64()
+		if acc != big.Exact && (ns == math.MinInt64 || ns == math.MaxInt64) {
+			return cty.UnknownVal(cty.String), function.NewArgErrorf(0, "duration is out of range")
+		}
+		return cty.StringVal(time.Duration(ns).String()), nil
+	},
+})
+
+var formatDateFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "format",
+			Type: cty.String,
+		},
+		{
+			Name: "timestamp",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		ts, err := timestampArg(args[1], 1)
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+		result, err := formatDate(args[0].AsString(), ts)
+		if err != nil {
+			return cty.UnknownVal(cty.String), function.NewArgError(0, err)
+		}
+		return cty.StringVal(result), nil
+	},
+})
+
+func timestampArg(val cty.Value, argIdx int) (time.Time, error) {
+	ts, err := time.Parse(time.RFC3339, val.AsString())
+	if err != nil {
+		return ts, function.NewArgErrorf(argIdx, "must be a timestamp in RFC 3339 format, like \"2018-01-02T15:04:05Z\"")
+	}
+	return ts, nil
+}
+
+// formatDate formats a time using the same specification syntax as
+// Terraform's formatdate function, where each sequence of a repeated letter
+// is a placeholder and literal letters must be written in single quotes.
+func formatDate(spec string, t time.Time) (string, error) {
+	var buf strings.Builder
+	for len(spec) > 0 {
+		ch := spec[0]
+
+		if ch == '\'' {
+			// Quoted text is literal, and a pair of quotes represents
+			// a literal quote both inside and outside of quoted text.
+			if len(spec) > 1 && spec[1] == '\'' {
+				buf.WriteByte('\'')
+				spec = spec[2:]
+				continue
+			}
+			i := 1
+			for {
+				if i >= len(spec) {
+					return "", fmt.Errorf("unterminated literal %s", spec)
+				}
+				if spec[i] == '\'' {
+					if i+1 < len(spec) && spec[i+1] == '\'' {
+						buf.WriteByte('\'')
+						i += 2
+						continue
+					}
+					break
+				}
+				buf.WriteByte(spec[i])
+				i++
+			}
+			spec = spec[i+1:]
+			continue
+		}
+
+		if !((ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')) {
+			buf.WriteByte(ch)
+			spec = spec[1:]
+			continue
+		}
+
+		n := 1
+		for n < len(spec) && spec[n] == ch {
+			n++
+		}
+		seq := spec[:n]
+		spec = spec[n:]
+
+		switch seq {
+		case "YYYY":
+			fmt.Fprintf(&buf, "%04d", t.Year())
+		case "YY":
+			fmt.Fprintf(&buf, "%02d", t.Year()%100)
+		case "MMMM":
+			buf.WriteString(t.Month().String())
+		case "MMM":
+			buf.WriteString(t.Month().String()[:3])
+		case "MM":
+			fmt.Fprintf(&buf, "%02d", t.Month())
+		case "M":
+			fmt.Fprintf(&buf, "%d", t.Month())
+		case "DD":
+			fmt.Fprintf(&buf, "%02d", t.Day())
+		case "D":
+			fmt.Fprintf(&buf, "%d", t.Day())
+		case "EEEE":
+			buf.WriteString(t.Weekday().String())
+		case "EEE":
+			buf.WriteString(t.Weekday().String()[:3])
+		case "hh":
+			fmt.Fprintf(&buf, "%02d", t.Hour())
+		case "h":
+			fmt.Fprintf(&buf, "%d", t.Hour())
+		case "HH":
+			fmt.Fprintf(&buf, "%02d", (t.Hour()+11)%12+1)
+		case "H":
+			fmt.Fprintf(&buf, "%d", (t.Hour()+11)%12+1)
+		case "AA":
+			buf.WriteString(t.Format("PM"))
+		case "aa":
+			buf.WriteString(t.Format("pm"))
+		case "mm":
+			fmt.Fprintf(&buf, "%02d", t.Minute())
+		case "m":
+			fmt.Fprintf(&buf, "%d", t.Minute())
+		case "ss":
+			fmt.Fprintf(&buf, "%02d", t.Second())
+		case "s":
+			fmt.Fprintf(&buf, "%d", t.Second())
+		case "ZZZZZ":
+			buf.WriteString(t.Format("-07:00"))
+		case "ZZZZ":
+			buf.WriteString(t.Format("-0700"))
+		case "ZZZ":
+			buf.WriteString(t.Format("MST"))
+		case "Z":
+			buf.WriteString(t.Format("Z07:00"))
+		default:
+			return "", fmt.Errorf("invalid date format verb %q: literal letters must be written in single quotes", seq)
+		}
+	}
+	return buf.String(), nil
+}
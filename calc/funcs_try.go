@@ -0,0 +1,117 @@
+package calc
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// can and try must evaluate their arguments themselves so that they can
+// intercept any errors, but functions normally receive only the values of
+// their arguments. To work around that, calls to these functions are
+// rewritten when parsed (see rewrite.go) so that each argument expression
+// is instead passed as a literal value of exprType, preceded by an object
+// containing the values of all of the variables the expressions refer to.
+// That object is evaluated in the scope of the call, and so it captures any
+// local variables from enclosing for expressions.
+
+// exprType is a capsule type whose values are unevaluated expressions.
+var exprType = cty.Capsule("expression", reflect.TypeOf((*hcl.Expression)(nil)).Elem())
+
+func exprVal(expr hcl.Expression) cty.Value {
+	return cty.CapsuleVal(exprType, &expr)
+}
+
+// scopeFunc produces an evaluation context for the deferred expressions
+// given to can and try, given the values of the variables they refer to.
+type scopeFunc func(vars map[string]cty.Value) *hcl.EvalContext
+
+// canFunc returns a function that evaluates its argument using the given
+// scope, returning true if it produces a value without any errors.
+func canFunc(scope scopeFunc) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "vars",
+				Type: cty.DynamicPseudoType,
+			},
+			{
+				Name: "expr",
+				Type: exprType,
+			},
+		},
+		Type: function.StaticReturnType(cty.Bool),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			if !args[0].Type().IsObjectType() {
+				return cty.UnknownVal(cty.Bool), errNotDeferred
+			}
+			ctx := scope(valueAttrs(args[0]))
+			val, diags := deferredExpr(args[1]).Value(ctx)
+			if diags.HasErrors() {
+				return cty.False, nil
+			}
+			if !val.IsWhollyKnown() {
+				// We can't know yet whether a later step would fail.
+				return cty.UnknownVal(cty.Bool), nil
+			}
+			return cty.True, nil
+		},
+	})
+}
+
+// tryFunc returns a function that evaluates each of its arguments in turn
+// using the given scope, returning the value of the first one that produces
+// a value without any errors.
+func tryFunc(scope scopeFunc) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "vars",
+				Type: cty.DynamicPseudoType,
+			},
+		},
+		VarParam: &function.Parameter{
+			Name: "exprs",
+			Type: exprType,
+		},
+		Type: function.StaticReturnType(cty.DynamicPseudoType),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			if !args[0].Type().IsObjectType() {
+				return cty.DynamicVal, errNotDeferred
+			}
+			ctx := scope(valueAttrs(args[0]))
+			var diags hcl.Diagnostics
+			for _, arg := range args[1:] {
+				val, valDiags := deferredExpr(arg).Value(ctx)
+				if !valDiags.HasErrors() {
+					if !val.IsWhollyKnown() {
+						// We can't know yet whether a later step would
+						// fail, so we can't decide which result to use.
+						return cty.DynamicVal, nil
+					}
+					return val, nil
+				}
+				diags = append(diags, valDiags...)
+			}
+			if len(args) == 1 {
+				// The rewriting step reports calls without any arguments,
+				// so this shouldn't happen.
+				return cty.DynamicVal, errors.New("at least one expression is required")
+			}
+			// Smuggle the diagnostics of all of the attempts out via the
+			// error channel, as for user-defined functions.
+			return cty.DynamicVal, diags
+		},
+	})
+}
+
+// errNotDeferred is returned if can or try is somehow called without its
+// arguments having been rewritten, such as when using argument expansion.
+var errNotDeferred = errors.New("the arguments must be given directly as expressions")
+
+func deferredExpr(val cty.Value) hcl.Expression {
+	return *val.EncapsulatedValue().(*hcl.Expression)
+}
@@ -0,0 +1,46 @@
+package calc
+
+import (
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// TestDeferredSelfCall checks that a user-defined function can't call
+// itself through the expressions given to can and try.
+func TestDeferredSelfCall(t *testing.T) {
+	tests := map[string]cty.Value{
+		"try(f(x), 0)": cty.NumberIntVal(0),
+		"can(f(x))":    cty.False,
+	}
+	for src, want := range tests {
+		table := NewTable()
+		if diags := table.DefineFunc("f", []string{"x"}, false, mustParse(t, src)); diags.HasErrors() {
+			t.Fatal(diags.Error())
+		}
+		got, diags := table.Eval(mustParse(t, "f(1)"))
+		if diags.HasErrors() {
+			t.Errorf("%s: %s", src, diags.Error())
+			continue
+		}
+		if !got.RawEquals(want) {
+			t.Errorf("%s: wrong result %#v, want %#v", src, got, want)
+		}
+	}
+}
+
+// TestDeferredUndefinedRange checks that a diagnostic about a variable
+// referred to inside can or try points at the reference itself.
+func TestDeferredUndefinedRange(t *testing.T) {
+	for _, src := range []string{"try(nope.x, 1)", "can(nope.x)"} {
+		_, diags := NewTable().Eval(mustParse(t, src))
+		if len(diags) != 1 || diags[0].Summary != "Variable not defined" {
+			t.Errorf("%s: wrong diagnostics: %s", src, diags.Error())
+			continue
+		}
+		subj := diags[0].Subject
+		if subj == nil || subj.Start.Column != 5 || subj.End.Column != 11 {
+			t.Errorf("%s: wrong subject %#v, want columns 5 to 11", src, subj)
+		}
+	}
+}
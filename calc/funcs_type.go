@@ -0,0 +1,313 @@
+package calc
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// typeType is a capsule type whose values are types. Type expressions given
+// as the second argument to convert are replaced with values of this type
+// when an expression is parsed, since type expressions are not otherwise
+// valid in expressions.
+var typeType = cty.Capsule("type", reflect.TypeOf(cty.Type{}))
+
+func typeVal(ty cty.Type) cty.Value {
+	return cty.CapsuleVal(typeType, &ty)
+}
+
+var toStringFunc = toTypeFunc(cty.String)
+var toNumberFunc = toTypeFunc(cty.Number)
+var toBoolFunc = toTypeFunc(cty.Bool)
+var toListFunc = toTypeFunc(cty.List(cty.DynamicPseudoType))
+var toSetFunc = toTypeFunc(cty.Set(cty.DynamicPseudoType))
+var toMapFunc = toTypeFunc(cty.Map(cty.DynamicPseudoType))
+
+// toTypeFunc builds a function that converts its argument to the given
+// type constraint, using the same rules as for automatic type conversion.
+func toTypeFunc(ty cty.Type) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name:      "val",
+				Type:      cty.DynamicPseudoType,
+				AllowNull: true,
+			},
+		},
+		Type: func(args []cty.Value) (cty.Type, error) {
+			return conversionType(args[0], ty, 0)
+		},
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return convertValue(args[0], ty, 0)
+		},
+	})
+}
+
+var typeOfFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name:             "val",
+			Type:             cty.DynamicPseudoType,
+			AllowNull:        true,
+			AllowUnknown:     true,
+			AllowDynamicType: true,
+		},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.StringVal(typeString(args[0].Type())), nil
+	},
+})
+
+// convertFunc converts a value to a type, given as a type expression. Unit
+// conversion has its own function, convertunit, so that a unit with the
+// same name as a type keyword can't be mistaken for the type.
+var convertFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name:      "val",
+			Type:      cty.DynamicPseudoType,
+			AllowNull: true,
+		},
+		{
+			Name: "type",
+			Type: cty.DynamicPseudoType,
+		},
+	},
+	Type: func(args []cty.Value) (cty.Type, error) {
+		target := args[1]
+		switch {
+		case target.Type().Equals(typeType):
+			if !target.IsKnown() {
+				return cty.DynamicPseudoType, nil
+			}
+			return conversionType(args[0], *target.EncapsulatedValue().(*cty.Type), 0)
+		case target.Type() == cty.String:
+			return cty.DynamicPseudoType, function.NewArgErrorf(1, "must be a type expression, like list(string); use convertunit to convert a quantity to another unit")
+		default:
+			return cty.DynamicPseudoType, function.NewArgErrorf(1, "must be a type expression, like list(string)")
+		}
+	},
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return convertValue(args[0], *args[1].EncapsulatedValue().(*cty.Type), 0)
+	},
+})
+
+// conversionType returns the type that the given value will have once
+// converted to the given type constraint, which may differ from the
+// constraint itself if it contains "any".
+func conversionType(val cty.Value, ty cty.Type, argIdx int) (cty.Type, error) {
+	if !val.IsKnown() {
+		// We can't predict the result type of an unknown value if the
+		// constraint contains "any", but the type check is still useful.
+		if convert.GetConversion(val.Type(), ty) == nil {
+			return cty.DynamicPseudoType, function.NewArgErrorf(argIdx, "cannot convert %s to %s", typeString(val.Type()), typeString(ty))
+		}
+		return cty.DynamicPseudoType, nil
+	}
+	result, err := convertValue(val, ty, argIdx)
+	if err != nil {
+		return cty.DynamicPseudoType, err
+	}
+	return result.Type(), nil
+}
+
+func convertValue(val cty.Value, ty cty.Type, argIdx int) (cty.Value, error) {
+	result, err := convertStructural(val, ty)
+	if err != nil {
+		return cty.DynamicVal, function.NewArgErrorf(argIdx, "cannot convert %s to %s: %s", typeString(val.Type()), typeString(ty), err)
+	}
+	return result, nil
+}
+
+// convertStructural converts the given value to the given type constraint.
+// It extends convert.Convert with the conversions between structural and
+// collection types that it doesn't support, such as from tuples to sets and
+// between object types, by converting each element separately.
+func convertStructural(val cty.Value, want cty.Type) (cty.Value, error) {
+	ty := val.Type()
+	switch {
+	case want == cty.DynamicPseudoType || ty.Equals(want):
+		return val, nil
+	case !val.IsKnown() || val.IsNull() || ty == cty.DynamicPseudoType:
+		return convert.Convert(val, want)
+
+	case want.IsObjectType() && (ty.IsObjectType() || ty.IsMapType()):
+		attrs := valueAttrs(val)
+		newAttrs := make(map[string]cty.Value, len(want.AttributeTypes()))
+		for name, aty := range want.AttributeTypes() {
+			av, exists := attrs[name]
+			if !exists {
+				return cty.DynamicVal, fmt.Errorf("attribute %q is required", name)
+			}
+			newAV, err := convertStructural(av, aty)
+			if err != nil {
+				return cty.DynamicVal, fmt.Errorf("attribute %q: %s", name, err)
+			}
+			newAttrs[name] = newAV
+		}
+		return cty.ObjectVal(newAttrs), nil
+
+	case want.IsTupleType() && (ty.IsTupleType() || ty.IsListType()):
+		etys := want.TupleElementTypes()
+		elems := val.AsValueSlice()
+		if len(elems) != len(etys) {
+			return cty.DynamicVal, fmt.Errorf("a sequence of %d elements is required", len(etys))
+		}
+		newElems := make([]cty.Value, len(elems))
+		for i, ev := range elems {
+			newEV, err := convertStructural(ev, etys[i])
+			if err != nil {
+				return cty.DynamicVal, fmt.Errorf("element %d: %s", i, err)
+			}
+			newElems[i] = newEV
+		}
+		return cty.TupleVal(newElems), nil
+
+	case want.IsMapType() && (ty.IsObjectType() || ty.IsMapType()):
+		attrs := valueAttrs(val)
+		if len(attrs) == 0 {
+			return cty.MapValEmpty(want.ElementType()), nil
+		}
+		names := make([]string, 0, len(attrs))
+		for name := range attrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		elems := make([]cty.Value, len(names))
+		for i, name := range names {
+			ev, err := convertStructural(attrs[name], want.ElementType())
+			if err != nil {
+				return cty.DynamicVal, fmt.Errorf("element %q: %s", name, err)
+			}
+			elems[i] = ev
+		}
+		elems, err := unifyElements(elems)
+		if err != nil {
+			return cty.DynamicVal, err
+		}
+		newAttrs := make(map[string]cty.Value, len(names))
+		for i, name := range names {
+			newAttrs[name] = elems[i]
+		}
+		return cty.MapVal(newAttrs), nil
+
+	case (want.IsListType() || want.IsSetType()) && (ty.IsTupleType() || ty.IsListType() || ty.IsSetType()):
+		elems := val.AsValueSlice()
+		if len(elems) == 0 {
+			if want.IsSetType() {
+				return cty.SetValEmpty(want.ElementType()), nil
+			}
+			return cty.ListValEmpty(want.ElementType()), nil
+		}
+		newElems := make([]cty.Value, len(elems))
+		for i, ev := range elems {
+			newEV, err := convertStructural(ev, want.ElementType())
+			if err != nil {
+				return cty.DynamicVal, fmt.Errorf("element %d: %s", i, err)
+			}
+			newElems[i] = newEV
+		}
+		newElems, err := unifyElements(newElems)
+		if err != nil {
+			return cty.DynamicVal, err
+		}
+		if want.IsSetType() {
+			return cty.SetVal(newElems), nil
+		}
+		return cty.ListVal(newElems), nil
+
+	default:
+		return convert.Convert(val, want)
+	}
+}
+
+// unifyElements converts all of the given values to a single type, so that
+// they can be the elements of a collection.
+func unifyElements(elems []cty.Value) ([]cty.Value, error) {
+	types := make([]cty.Type, len(elems))
+	for i, ev := range elems {
+		types[i] = ev.Type()
+	}
+	ety, convs := convert.UnifyUnsafe(types)
+	if ety == cty.NilType {
+		return nil, fmt.Errorf("all elements must have the same type")
+	}
+	ret := make([]cty.Value, len(elems))
+	for i, ev := range elems {
+		if convs[i] != nil {
+			var err error
+			ev, err = convs[i](ev)
+			if err != nil {
+				return nil, err
+			}
+		}
+		ret[i] = ev
+	}
+	return ret, nil
+}
+
+// typeString returns the type expression for the given type. Unlike
+// typeexpr.TypeString, it also supports the capsule types used by the
+// calculator by using their names.
+func typeString(ty cty.Type) string {
+	switch {
+	case ty == cty.String:
+		return "string"
+	case ty == cty.Bool:
+		return "bool"
+	case ty == cty.Number:
+		return "number"
+	case ty == cty.DynamicPseudoType:
+		return "any"
+	case ty.IsCapsuleType():
+		return ty.FriendlyName()
+	case ty.IsListType():
+		return fmt.Sprintf("list(%s)", typeString(ty.ElementType()))
+	case ty.IsSetType():
+		return fmt.Sprintf("set(%s)", typeString(ty.ElementType()))
+	case ty.IsMapType():
+		return fmt.Sprintf("map(%s)", typeString(ty.ElementType()))
+	case ty.IsObjectType():
+		atys := ty.AttributeTypes()
+		names := make([]string, 0, len(atys))
+		for name := range atys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var buf bytes.Buffer
+		buf.WriteString("object({")
+		for i, name := range names {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			if !hclsyntax.ValidIdentifier(name) {
+				name = fmt.Sprintf("%q", name)
+			}
+			fmt.Fprintf(&buf, "%s=%s", name, typeString(atys[name]))
+		}
+		buf.WriteString("})")
+		return buf.String()
+	case ty.IsTupleType():
+		var buf bytes.Buffer
+		buf.WriteString("tuple([")
+		for i, ety := range ty.TupleElementTypes() {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			buf.WriteString(typeString(ety))
+		}
+		buf.WriteString("])")
+		return buf.String()
+	default:
+		// Should never happen, since the above is exhaustive
+		return ty.FriendlyName()
+	}
+}
@@ -0,0 +1,38 @@
+package calc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestConvert(t *testing.T) {
+	table := NewTable()
+
+	got, diags := table.Eval(mustParse(t, `convert([1, 2], set(string))`))
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	want := cty.SetVal([]cty.Value{cty.StringVal("1"), cty.StringVal("2")})
+	if !got.RawEquals(want) {
+		t.Errorf("wrong result %#v, want %#v", got, want)
+	}
+
+	// Units aren't types, so convert rejects them.
+	_, diags = table.Eval(mustParse(t, `convert(quantity("1 GiB"), "MiB")`))
+	if !diags.HasErrors() || !strings.Contains(diags.Error(), "use convertunit") {
+		t.Errorf("wrong diagnostics for a unit: %s", diags.Error())
+	}
+}
+
+func TestConvertUnit(t *testing.T) {
+	table := NewTable()
+	got, diags := table.Eval(mustParse(t, `convertunit(quantity("1 GiB"), "MiB")`))
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	if str, ok := QuantityString(got); !ok || str != "1024 MiB" {
+		t.Errorf("wrong result %q", str)
+	}
+}
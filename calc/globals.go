@@ -3,31 +3,86 @@ package calc
 import (
 	"fmt"
 
-	"github.com/hashicorp/hcl2/hcl"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/function"
 	"github.com/zclconf/go-cty/cty/function/stdlib"
 )
 
-var globalCtx = &hcl.EvalContext{
-	Functions: map[string]function.Function{
-		"coalesce":   stdlib.CoalesceFunc,
-		"concat":     stdlib.ConcatFunc,
-		"format":     stdlib.FormatFunc,
-		"formatlist": stdlib.FormatListFunc,
-		"hasindex":   stdlib.HasIndexFunc,
-		"int":        stdlib.IntFunc,
-		"jsondecode": stdlib.JSONDecodeFunc,
-		"jsonencode": stdlib.JSONEncodeFunc,
-		"length":     stdlib.LengthFunc,
-		"lower":      stdlib.LowerFunc,
-		"max":        stdlib.MaxFunc,
-		"min":        stdlib.MinFunc,
-		"reverse":    stdlib.ReverseFunc,
-		"strlen":     stdlib.StrlenFunc,
-		"substr":     stdlib.SubstrFunc,
-		"upper":      stdlib.UpperFunc,
-	},
+// minimalFuncs are the functions of the minimal profile that don't depend
+// on the settings of a table.
+var minimalFuncs = map[string]function.Function{
+	"base64decode":   base64DecodeFunc,
+	"base64encode":   base64EncodeFunc,
+	"base64sha256":   base64SHA256Func,
+	"bitand":         bitAndFunc,
+	"bitnot":         bitNotFunc,
+	"bitor":          bitOrFunc,
+	"bitxor":         bitXorFunc,
+	"cidrcontains":   cidrContainsFunc,
+	"cidrhost":       cidrHostFunc,
+	"cidrnetmask":    cidrNetmaskFunc,
+	"cidrsubnet":     cidrSubnetFunc,
+	"cidrsubnets":    cidrSubnetsFunc,
+	"coalesce":       stdlib.CoalesceFunc,
+	"concat":         stdlib.ConcatFunc,
+	"crc32":          crc32Func,
+	"convert":        convertFunc,
+	"convertunit":    convertUnitFunc,
+	"csvdecode":      stdlib.CSVDecodeFunc,
+	"format":         stdlib.FormatFunc,
+	"formatbytes":    formatBytesFunc,
+	"formatdate":     formatDateFunc,
+	"formatduration": formatDurationFunc,
+	"formatint":      formatIntFunc,
+	"formatlist":     stdlib.FormatListFunc,
+	"hasindex":       stdlib.HasIndexFunc,
+	"humanize":       humanizeFunc,
+	"int":            stdlib.IntFunc,
+	"ipinfo":         ipInfoFunc,
+	"jsondecode":     stdlib.JSONDecodeFunc,
+	"jsonencode":     stdlib.JSONEncodeFunc,
+	"length":         stdlib.LengthFunc,
+	"lower":          stdlib.LowerFunc,
+	"max":            stdlib.MaxFunc,
+	"md5":            md5Func,
+	"min":            stdlib.MinFunc,
+	"parseint":       parseIntFunc,
+	"parsebytes":     parseBytesFunc,
+	"parseduration":  parseDurationFunc,
+	"qadd":           quantityAddFunc,
+	"qdiv":           quantityDivideFunc,
+	"qmul":           quantityMultiplyFunc,
+	"qsub":           quantitySubtractFunc,
+	"quantity":       quantityFunc,
+	"qvalue":         quantityValueFunc,
+	"reverse":        stdlib.ReverseFunc,
+	"semver":         semverFunc,
+	"semvercmp":      semverCmpFunc,
+	"semvermatch":    semverMatchFunc,
+	"semversort":     semverSortFunc,
+	"sha1":           sha1Func,
+	"sha256":         sha256Func,
+	"sha512":         sha512Func,
+	"shl":            shlFunc,
+	"shr":            shrFunc,
+	"strlen":         stdlib.StrlenFunc,
+	"substr":         stdlib.SubstrFunc,
+	"thousands":      thousandsFunc,
+	"timeadd":        timeAddFunc,
+	"timecmp":        timeCmpFunc,
+	"timezone":       timeZoneFunc,
+	"tobool":         toBoolFunc,
+	"tolist":         toListFunc,
+	"tomap":          toMapFunc,
+	"tonumber":       toNumberFunc,
+	"toset":          toSetFunc,
+	"tostring":       toStringFunc,
+	"typeof":         typeOfFunc,
+	"upper":          stdlib.UpperFunc,
+	"urlencode":      urlEncodeFunc,
+	"uuidv5":         uuidV5Func,
+	"yamldecode":     yamlDecodeFunc,
+	"yamlencode":     yamlEncodeFunc,
 }
 
 func noSelfCallFunc(name string) function.Function {
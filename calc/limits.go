@@ -0,0 +1,221 @@
+package calc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// Limits bounds the resources that a single evaluation may use, so that an
+// expression like range(100000000) can't hang the calculator or exhaust its
+// memory. A zero value in any field means that there is no limit of that
+// kind.
+//
+// The limits are checked after the fact, when a function is called or
+// returns and when the evaluation of a symbol is complete, since HCL can't
+// interrupt the evaluation of an expression. An expression that builds a
+// large value without calling functions, such as nested for expressions,
+// is therefore only stopped once it has been built, and may run well past
+// the timeout before then.
+type Limits struct {
+	// Timeout is the longest time that an evaluation may run for.
+	Timeout time.Duration
+
+	// MaxElements is the largest total number of elements that any value
+	// may contain, counting the elements of nested collections as well as
+	// of the outermost one.
+	MaxElements int
+
+	// MaxStringLength is the length in bytes of the longest string that
+	// any value may contain.
+	MaxStringLength int
+}
+
+// DefaultLimits are the limits that new tables use.
+var DefaultLimits = Limits{
+	Timeout:         30 * time.Second,
+	MaxElements:     1000000,
+	MaxStringLength: 16 << 20,
+}
+
+// SetLimits changes the limits that apply to each evaluation.
+func (t *Table) SetLimits(limits Limits) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.limits = limits
+	t.cache.clear()
+}
+
+// Limits returns the limits that apply to each evaluation.
+func (t *Table) Limits() Limits {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.limits
+}
+
+// guard enforces the table's limits and the cancellation of its context
+// during a single evaluation.
+//
+// Evaluation of an HCL expression can't be interrupted directly, so the
+// guard is checked whenever a function is called and between the
+// evaluations of symbols. A cancelled evaluation therefore stops at the
+// next of those, and the result of each is checked against the limits.
+type guard struct {
+	ctx    context.Context
+	limits Limits
+}
+
+// startGuard begins an evaluation using the given context, returning the
+// guard for it and a function that must be called once it's complete. It
+// must only be called on a view, since each view is used by a single
+// evaluation.
+func (t *Table) startGuard(ctx context.Context) (*guard, func()) {
+	cancel := func() {}
+	if t.limits.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t.limits.Timeout)
+	}
+	g := &guard{
+		ctx:    ctx,
+		limits: t.limits,
+	}
+	t.active = g
+	return g, func() {
+		t.active = nil
+		cancel()
+	}
+}
+
+// err returns an error if the evaluation has been cancelled or has run out
+// of time.
+func (g *guard) err() error {
+	if g == nil {
+		return nil
+	}
+	switch g.ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return fmt.Errorf("evaluation did not complete within the time limit")
+	default:
+		return fmt.Errorf("evaluation was cancelled")
+	}
+}
+
+// stoppedDiags returns a diagnostic explaining why the evaluation stopped,
+// or nil if it hasn't.
+func (g *guard) stoppedDiags() hcl.Diagnostics {
+	if g == nil || g.ctx.Err() == nil {
+		return nil
+	}
+	var diags hcl.Diagnostics
+	if g.ctx.Err() == context.DeadlineExceeded {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Evaluation timed out",
+			Detail:   "The evaluation did not complete within the time limit, so it was stopped.",
+		})
+	} else {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Evaluation cancelled",
+			Detail:   "The evaluation was cancelled before it completed.",
+		})
+	}
+	return diags
+}
+
+// checkValue returns an error if the given value exceeds the size limits.
+func (g *guard) checkValue(val cty.Value) error {
+	if g == nil {
+		return nil
+	}
+	count := 0
+	return g.walkValue(val, &count)
+}
+
+func (g *guard) walkValue(val cty.Value, count *int) error {
+	if !val.IsKnown() || val.IsNull() {
+		return nil
+	}
+
+	ty := val.Type()
+	switch {
+	case ty == cty.String:
+		if max := g.limits.MaxStringLength; max > 0 && len(val.AsString()) > max {
+			return fmt.Errorf("the result contains a string longer than the limit of %d bytes", max)
+		}
+	case ty.IsListType() || ty.IsSetType() || ty.IsMapType() || ty.IsTupleType() || ty.IsObjectType():
+		for it := val.ElementIterator(); it.Next(); {
+			*count++
+			if max := g.limits.MaxElements; max > 0 && *count > max {
+				return fmt.Errorf("the result has more than the limit of %d elements", max)
+			}
+			_, elem := it.Element()
+			if err := g.walkValue(elem, count); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resultDiags returns diagnostics about the given result of the given
+// expression if it exceeds the size limits.
+func (g *guard) resultDiags(val cty.Value, expr Expression) hcl.Diagnostics {
+	err := g.checkValue(val)
+	if err == nil {
+		return nil
+	}
+	rng := expr.Range()
+	var diags hcl.Diagnostics
+	diags = append(diags, &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Result too large",
+		Detail:   fmt.Sprintf("This expression cannot be evaluated because %s.", err),
+		Subject:  &rng,
+	})
+	return diags
+}
+
+// guardFuncs returns a copy of the given functions with each wrapped by
+// guardFunc.
+func (t *Table) guardFuncs(funcs map[string]function.Function) map[string]function.Function {
+	ret := make(map[string]function.Function, len(funcs))
+	for name, f := range funcs {
+		ret[name] = t.guardFunc(f)
+	}
+	return ret
+}
+
+// guardFunc wraps the given function so that it fails if the current
+// evaluation has been stopped, and so that its result is checked against
+// the table's limits.
+func (t *Table) guardFunc(f function.Function) function.Function {
+	return function.New(&function.Spec{
+		Params:   f.Params(),
+		VarParam: f.VarParam(),
+		Type: func(args []cty.Value) (cty.Type, error) {
+			if err := t.active.err(); err != nil {
+				return cty.DynamicPseudoType, err
+			}
+			return f.ReturnTypeForValues(args)
+		},
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			if err := t.active.err(); err != nil {
+				return cty.DynamicVal, err
+			}
+			result, err := f.Call(args)
+			if err != nil {
+				return result, err
+			}
+			if err := t.active.checkValue(result); err != nil {
+				return cty.DynamicVal, err
+			}
+			return result, nil
+		},
+	})
+}
@@ -0,0 +1,114 @@
+package calc
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// nameIndex keeps the names of a table's symbols in lexicographical order,
+// so that the names with a particular prefix can be found without
+// considering all of the others.
+//
+// Keeping a slice sorted as each name is added would make loading a large
+// file take quadratic time, so additions and removals are instead
+// collected and merged into the sorted names the next time they're needed.
+type nameIndex struct {
+	mu      sync.Mutex
+	sorted  []string
+	added   symbolSet
+	removed symbolSet
+}
+
+func newNameIndex() *nameIndex {
+	return &nameIndex{
+		added:   newSymbolSet(),
+		removed: newSymbolSet(),
+	}
+}
+
+// Add adds the given name, which must not already be in the index.
+func (idx *nameIndex) Add(name string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.removed.Has(name) {
+		// It's still present in the sorted names.
+		idx.removed.Remove(name)
+		return
+	}
+	idx.added.Add(name)
+}
+
+// Remove removes the given name, which must be in the index.
+func (idx *nameIndex) Remove(name string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.added.Has(name) {
+		idx.added.Remove(name)
+		return
+	}
+	idx.removed.Add(name)
+}
+
+// WithPrefix returns the names that start with the given prefix, in
+// lexicographical order.
+func (idx *nameIndex) WithPrefix(prefix string) []string {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.merge()
+
+	var ret []string
+	for i := sort.SearchStrings(idx.sorted, prefix); i < len(idx.sorted); i++ {
+		if !strings.HasPrefix(idx.sorted[i], prefix) {
+			break
+		}
+		ret = append(ret, idx.sorted[i])
+	}
+	return ret
+}
+
+// merge brings the sorted names up to date with the pending additions and
+// removals.
+func (idx *nameIndex) merge() {
+	if idx.added.Empty() && idx.removed.Empty() {
+		return
+	}
+	added := idx.added.AppendNames(nil)
+	merged := make([]string, 0, len(idx.sorted)+len(added)-len(idx.removed))
+	i := 0
+	for _, name := range idx.sorted {
+		if idx.removed.Has(name) {
+			continue
+		}
+		for i < len(added) && added[i] < name {
+			merged = append(merged, added[i])
+			i++
+		}
+		merged = append(merged, name)
+	}
+	merged = append(merged, added[i:]...)
+
+	idx.sorted = merged
+	idx.added = newSymbolSet()
+	idx.removed = newSymbolSet()
+}
+
+// nameHeap is a min-heap of names for use with container/heap, which
+// visitSymbols uses to always visit the lexicographically-first of the
+// symbols that are ready.
+type nameHeap []string
+
+func (h nameHeap) Len() int           { return len(h) }
+func (h nameHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h nameHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *nameHeap) Push(x interface{}) {
+	*h = append(*h, x.(string))
+}
+
+func (h *nameHeap) Pop() interface{} {
+	old := *h
+	name := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return name
+}
@@ -0,0 +1,142 @@
+package calc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// An Option customizes a table created with NewTable.
+//
+// The options that take names panic if given an invalid name, since the
+// names are expected to be fixed by the program embedding the calculator
+// rather than given by its user.
+type Option func(t *Table)
+
+// WithFunction makes the given function available to the table's
+// expressions under the given name, in addition to the functions of its
+// profile. If the profile has a function of the same name then the given
+// function is used instead, except that the reserved names can't be
+// overridden, and cause a panic; see ReservedFunc.
+func WithFunction(name string, f function.Function) Option {
+	return func(t *Table) {
+		mustBeIdentifier("function", name)
+		if ReservedFunc(name) {
+			panic(fmt.Sprintf("function name %q is reserved", name))
+		}
+		t.hostFuncs[name] = f
+		t.hidden.Remove(name)
+	}
+}
+
+// WithImpureFunction is like WithFunction, but also marks the function as
+// impure, meaning that it may return a different result each time it is
+// called with the same arguments, such as if it reads external state.
+func WithImpureFunction(name string, f function.Function) Option {
+	return func(t *Table) {
+		WithFunction(name, f)(t)
+		t.impure.Add(name)
+	}
+}
+
+// WithoutFunctions hides the functions with the given names, so that they
+// are unavailable regardless of the table's profile.
+func WithoutFunctions(names ...string) Option {
+	return func(t *Table) {
+		for _, name := range names {
+			delete(t.hostFuncs, name)
+			t.hidden.Add(name)
+		}
+	}
+}
+
+// WithConstant defines a read-only symbol with the given name and value.
+func WithConstant(name string, val cty.Value) Option {
+	return func(t *Table) {
+		mustBeIdentifier("constant", name)
+
+		// The source of a constant is only for display, so we'll use JSON
+		// syntax where possible since that is also valid in expressions.
+		src := []byte("(constant)")
+		if buf, err := ctyjson.Marshal(val, val.Type()); err == nil {
+			src = buf
+		}
+		t.define(name, Expression{
+			Expression: &hclsyntax.LiteralValueExpr{
+				Val: val,
+				SrcRange: hcl.Range{
+					Filename: name,
+				},
+			},
+			Source: src,
+		})
+		t.readOnly.Add(name)
+	}
+}
+
+// WithProfile selects the table's function profile. See SetProfile.
+func WithProfile(name string) Option {
+	return func(t *Table) {
+		if _, exists := profiles[name]; !exists {
+			panic(fmt.Sprintf("no profile is named %q", name))
+		}
+		t.profile = name
+	}
+}
+
+// WithClock sets the table's clock. See SetClock.
+func WithClock(now func() time.Time) Option {
+	return func(t *Table) {
+		t.clock = now
+	}
+}
+
+// WithSeed sets the seed for the table's pseudo-random functions. See
+// SetSeed.
+func WithSeed(seed int64) Option {
+	return func(t *Table) {
+		t.seed = seed
+	}
+}
+
+// WithBaseDir sets the directory that the table's file functions are
+// restricted to. See SetBaseDir.
+func WithBaseDir(dir string) Option {
+	return func(t *Table) {
+		t.baseDir = dir
+	}
+}
+
+// WithLimits sets the limits that apply to each evaluation. See SetLimits.
+func WithLimits(limits Limits) Option {
+	return func(t *Table) {
+		t.limits = limits
+	}
+}
+
+// WithParallelism sets the largest number of symbols that an evaluation may
+// evaluate at the same time. See SetParallelism.
+func WithParallelism(n int) Option {
+	return func(t *Table) {
+		t.parallelism = n
+	}
+}
+
+// WithRefuseCycles sets whether Define and Batch.Commit refuse changes that
+// would create a dependency cycle. See SetRefuseCycles.
+func WithRefuseCycles(refuse bool) Option {
+	return func(t *Table) {
+		t.refuseCycles = refuse
+	}
+}
+
+func mustBeIdentifier(kind, name string) {
+	if !hclsyntax.ValidIdentifier(name) {
+		panic(fmt.Sprintf("invalid %s name %q", kind, name))
+	}
+}
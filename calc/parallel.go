@@ -0,0 +1,132 @@
+package calc
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// SetParallelism changes the largest number of symbols that an evaluation
+// may evaluate at the same time, which is the number of CPUs that Go may
+// use by default. Symbols are only evaluated at the same time if neither
+// depends on the other, and a parallelism of one or less evaluates them
+// one at a time.
+func (t *Table) SetParallelism(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.parallelism = n
+}
+
+// Parallelism returns the largest number of symbols that an evaluation may
+// evaluate at the same time.
+func (t *Table) Parallelism() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.parallelism
+}
+
+func defaultParallelism() int {
+	return runtime.GOMAXPROCS(0)
+}
+
+// symbolResult is the outcome of evaluating a single symbol.
+type symbolResult struct {
+	val   cty.Value
+	diags hcl.Diagnostics
+}
+
+// evalSymbols evaluates the given symbols in a child of the given context,
+// using up to the given number of goroutines. Each symbol is evaluated
+// once all of the symbols it requires have been, so any symbols that don't
+// depend on each other may be evaluated at the same time.
+//
+// The symbols are returned in the order that visitSymbols visits them,
+// along with their results in the same order, so the results don't depend
+// on the order the evaluations happen to complete in. The symbols that
+// can't be evaluated because of a dependency cycle are also returned.
+func (t *Table) evalSymbols(syms symbolSet, ctx *hcl.EvalContext, workers int) ([]string, []symbolResult, symbolSet) {
+	var order []string
+	cycled := t.visitSymbols(syms, func(name string, expr Expression) {
+		order = append(order, name)
+	})
+	index := make(map[string]int, len(order))
+	for i, name := range order {
+		index[name] = i
+	}
+	results := make([]symbolResult, len(order))
+
+	// Each symbol gets its own context containing the values of the
+	// symbols it requires, which are complete by the time it's evaluated.
+	eval := func(i int) {
+		name := order[i]
+		if t.active.err() != nil {
+			results[i] = symbolResult{val: cty.DynamicVal}
+			return
+		}
+		expr, defined := t.syms[name]
+		if !defined {
+			expr = missingExpr
+		}
+		symCtx := ctx.NewChild()
+		symCtx.Variables = make(map[string]cty.Value, len(t.reqs[name]))
+		for reqdName := range t.reqs[name] {
+			symCtx.Variables[reqdName] = results[index[reqdName]].val
+		}
+		val, diags := t.symbolValue(name, expr, symCtx)
+		results[i] = symbolResult{val: val, diags: diags}
+	}
+
+	if workers > len(order) {
+		workers = len(order)
+	}
+	if workers <= 1 {
+		// visitSymbols already put the symbols in an order where each
+		// comes after those it requires.
+		for i := range order {
+			eval(i)
+		}
+		return order, results, cycled
+	}
+
+	// pending counts the symbols that each symbol is still waiting for,
+	// and a symbol is sent to ready once that reaches zero. The buffer is
+	// large enough for every symbol, so sending never blocks.
+	var mu sync.Mutex
+	pending := make([]int, len(order))
+	ready := make(chan int, len(order))
+	for i, name := range order {
+		pending[i] = len(t.reqs[name])
+		if pending[i] == 0 {
+			ready <- i
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(order))
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range ready {
+				eval(i)
+				mu.Lock()
+				for dependent := range t.reqdBy[order[i]] {
+					j, visited := index[dependent]
+					if !visited {
+						continue
+					}
+					pending[j]--
+					if pending[j] == 0 {
+						ready <- j
+					}
+				}
+				mu.Unlock()
+				wg.Done()
+			}
+		}()
+	}
+	wg.Wait()
+	close(ready)
+
+	return order, results, cycled
+}
@@ -0,0 +1,267 @@
+package calc
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+// A profile is a named set of functions that a table makes available to
+// its expressions. The profiles are:
+//
+//	minimal    the calculator's own functions
+//	terraform  the Terraform built-in functions, with the same behavior
+//	all        both of the above, preferring Terraform's behavior where
+//	           a function of the same name exists in both
+//
+// The terraform profile includes all of Terraform's functions except those
+// that can't behave the same way in the calculator: uuid and bcrypt, which
+// produce a different result on each call, the ones that only make sense
+// during a Terraform run, such as sensitive and plantimestamp, and
+// pathexpand, rsadecrypt, templatestring, textencodebase64 and
+// textdecodebase64, which need support the calculator doesn't have.
+//
+// Each profile is a function that builds the set for a particular table,
+// since some functions depend on the settings of the table.
+var profiles = map[string]func(t *Table) map[string]function.Function{
+	"minimal":   (*Table).minimalFuncs,
+	"terraform": (*Table).terraformFuncs,
+	"all":       (*Table).allFuncs,
+}
+
+// DefaultProfile is the profile that new tables use.
+const DefaultProfile = "minimal"
+
+// ProfileNames returns the names of the available function profiles, in
+// lexicographical order.
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProfilesWithFunc returns the names of the profiles that have a builtin
+// function with the given name, in lexicographical order.
+func ProfilesWithFunc(name string) []string {
+	t := NewTable()
+	var names []string
+	for _, profile := range ProfileNames() {
+		if _, exists := profiles[profile](t)[name]; exists {
+			names = append(names, profile)
+		}
+	}
+	return names
+}
+
+// SetProfile changes the set of functions available to the table's
+// expressions to the profile with the given name. Any functions added or
+// hidden by the options given to NewTable still apply.
+func (t *Table) SetProfile(name string) error {
+	if _, exists := profiles[name]; !exists {
+		return fmt.Errorf("no profile is named %q; must be one of %s", name, strings.Join(ProfileNames(), ", "))
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.profile = name
+	t.cache.clear()
+	return nil
+}
+
+// Profile returns the name of the table's function profile.
+func (t *Table) Profile() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.profile
+}
+
+// profileFuncs builds the functions of the table's profile, including any
+// added or hidden by the options given to NewTable.
+func (t *Table) profileFuncs() map[string]function.Function {
+	funcs := profiles[t.profile](t)
+	for name := range t.hidden {
+		delete(funcs, name)
+	}
+	for name, f := range t.hostFuncs {
+		funcs[name] = f
+	}
+	return funcs
+}
+
+// impureFuncs are the builtin functions that may return a different result
+// each time they are called with the same arguments, because they read
+// the clock, the environment or the filesystem.
+var impureFuncs = []string{
+	"env",
+	"file",
+	"filebase64",
+	"filebase64sha256",
+	"filebase64sha512",
+	"fileexists",
+	"filemd5",
+	"fileset",
+	"filesha1",
+	"filesha256",
+	"filesha512",
+	"templatefile",
+	"timestamp",
+}
+
+func (t *Table) minimalFuncs() map[string]function.Function {
+	funcs := make(map[string]function.Function, len(minimalFuncs)+16)
+	for name, f := range minimalFuncs {
+		funcs[name] = f
+	}
+	funcs["can"] = canFunc(t.deferredScope)
+	funcs["env"] = envFunc(t.lookupEnv)
+	funcs["file"] = fileFunc(t.resolvePath)
+	funcs["filebase64"] = fileBase64Func(t.resolvePath)
+	funcs["fileexists"] = fileExistsFunc(t.resolvePath)
+	funcs["fileset"] = fileSetFunc(t.resolvePath)
+	funcs["random"] = randomFunc(t.rand)
+	funcs["sample"] = sampleFunc(t.rand)
+	funcs["shuffle"] = shuffleFunc(t.rand)
+	funcs["templatefile"] = templateFileFunc(t.resolvePath, t.builtins)
+	funcs["timestamp"] = timestampFunc(t.now)
+	funcs["try"] = tryFunc(t.deferredScope)
+	funcs["uuid"] = uuidFunc(t.rand)
+	return funcs
+}
+
+func (t *Table) terraformFuncs() map[string]function.Function {
+	funcs := make(map[string]function.Function, len(terraformFuncs)+16)
+	for name, f := range terraformFuncs {
+		funcs[name] = f
+	}
+	funcs["can"] = canFunc(t.deferredScope)
+	funcs["file"] = fileFunc(t.resolvePath)
+	funcs["filebase64"] = fileBase64Func(t.resolvePath)
+	funcs["filebase64sha256"] = fileHashFunc(t.resolvePath, sha256.New, base64.StdEncoding.EncodeToString)
+	funcs["filebase64sha512"] = fileHashFunc(t.resolvePath, sha512.New, base64.StdEncoding.EncodeToString)
+	funcs["fileexists"] = fileExistsFunc(t.resolvePath)
+	funcs["filemd5"] = fileHashFunc(t.resolvePath, md5.New, hex.EncodeToString)
+	funcs["fileset"] = dirFileSetFunc(t.resolvePath)
+	funcs["filesha1"] = fileHashFunc(t.resolvePath, sha1.New, hex.EncodeToString)
+	funcs["filesha256"] = fileHashFunc(t.resolvePath, sha256.New, hex.EncodeToString)
+	funcs["filesha512"] = fileHashFunc(t.resolvePath, sha512.New, hex.EncodeToString)
+	funcs["templatefile"] = templateFileFunc(t.resolvePath, t.builtins)
+	funcs["timestamp"] = timestampFunc(t.now)
+	funcs["try"] = tryFunc(t.deferredScope)
+	return funcs
+}
+
+func (t *Table) allFuncs() map[string]function.Function {
+	funcs := t.minimalFuncs()
+	for name, f := range t.terraformFuncs() {
+		funcs[name] = f
+	}
+	return funcs
+}
+
+// terraformFuncs are the functions of the terraform profile that don't
+// depend on the settings of a table.
+var terraformFuncs = map[string]function.Function{
+	"abs":             stdlib.AbsoluteFunc,
+	"abspath":         absPathFunc,
+	"alltrue":         allTrueFunc,
+	"anytrue":         anyTrueFunc,
+	"base64decode":    base64DecodeFunc,
+	"base64encode":    base64EncodeFunc,
+	"base64gzip":      base64GzipFunc,
+	"base64sha256":    base64SHA256Func,
+	"base64sha512":    base64SHA512Func,
+	"basename":        basenameFunc,
+	"ceil":            ceilFunc,
+	"chomp":           chompFunc,
+	"chunklist":       chunkListFunc,
+	"cidrhost":        cidrHostFunc,
+	"cidrnetmask":     cidrNetmaskFunc,
+	"cidrsubnet":      cidrSubnetFunc,
+	"cidrsubnets":     cidrSubnetsFunc,
+	"coalesce":        coalesceNonEmptyFunc,
+	"coalescelist":    coalesceListFunc,
+	"compact":         compactFunc,
+	"concat":          stdlib.ConcatFunc,
+	"contains":        containsFunc,
+	"csvdecode":       stdlib.CSVDecodeFunc,
+	"dirname":         dirnameFunc,
+	"distinct":        distinctFunc,
+	"element":         elementFunc,
+	"endswith":        endsWithFunc,
+	"flatten":         flattenFunc,
+	"floor":           floorFunc,
+	"format":          stdlib.FormatFunc,
+	"formatdate":      formatDateFunc,
+	"formatlist":      stdlib.FormatListFunc,
+	"indent":          indentFunc,
+	"index":           indexOfFunc,
+	"join":            joinFunc,
+	"jsondecode":      stdlib.JSONDecodeFunc,
+	"jsonencode":      stdlib.JSONEncodeFunc,
+	"keys":            keysFunc,
+	"length":          lengthFunc,
+	"log":             logFunc,
+	"lookup":          lookupFunc,
+	"lower":           stdlib.LowerFunc,
+	"matchkeys":       matchKeysFunc,
+	"max":             stdlib.MaxFunc,
+	"md5":             md5Func,
+	"merge":           mergeFunc,
+	"min":             stdlib.MinFunc,
+	"one":             oneFunc,
+	"parseint":        parseIntFunc,
+	"pow":             powFunc,
+	"range":           rangeFunc,
+	"regex":           regexFunc,
+	"regexall":        regexAllFunc,
+	"replace":         replaceFunc,
+	"reverse":         reverseListFunc,
+	"setintersection": setIntersectionFunc,
+	"setproduct":      setProductFunc,
+	"setsubtract":     setSubtractFunc,
+	"setunion":        setUnionFunc,
+	"sha1":            sha1Func,
+	"sha256":          sha256Func,
+	"sha512":          sha512Func,
+	"signum":          signumFunc,
+	"slice":           sliceFunc,
+	"sort":            sortFunc,
+	"split":           splitFunc,
+	"startswith":      startsWithFunc,
+	"strcontains":     strContainsFunc,
+	"strrev":          stdlib.ReverseFunc,
+	"substr":          stdlib.SubstrFunc,
+	"sum":             sumFunc,
+	"timeadd":         timeAddFunc,
+	"timecmp":         timeCmpFunc,
+	"title":           titleFunc,
+	"tobool":          toBoolFunc,
+	"tolist":          toListFunc,
+	"tomap":           toMapFunc,
+	"tonumber":        toNumberFunc,
+	"toset":           toSetFunc,
+	"tostring":        toStringFunc,
+	"transpose":       transposeFunc,
+	"trim":            trimFunc,
+	"trimprefix":      trimPrefixFunc,
+	"trimspace":       trimSpaceFunc,
+	"trimsuffix":      trimSuffixFunc,
+	"upper":           stdlib.UpperFunc,
+	"urlencode":       urlEncodeFunc,
+	"uuidv5":          uuidV5Func,
+	"values":          valuesFunc,
+	"yamldecode":      yamlDecodeFunc,
+	"yamlencode":      quotedYAMLEncodeFunc,
+	"zipmap":          zipMapFunc,
+}
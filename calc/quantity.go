@@ -0,0 +1,486 @@
+package calc
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// Quantity is a number with an associated unit of measure, such as 512 MiB,
+// 3 h or 10 Gbps. Quantities are transported through the cty type system
+// using the capsule type QuantityType.
+//
+// HCL's arithmetic operators work only with numbers, so arithmetic with
+// quantities is done using the qadd, qsub, qmul and qdiv functions, which
+// check that the dimensions of their operands are compatible.
+type Quantity struct {
+	// base is the magnitude of the quantity in the base units of its
+	// dimension: bits and seconds.
+	base *big.Float
+	dim  dimension
+
+	// unit is the unit the quantity is presented in, which always has the
+	// same dimension as the quantity itself.
+	unit unit
+}
+
+// QuantityType is the cty capsule type used to represent quantities.
+var QuantityType = cty.Capsule("quantity", reflect.TypeOf(Quantity{}))
+
+// dimension is a dimension expressed as the exponents of the base
+// dimensions, information (bits) and time (seconds).
+type dimension struct {
+	Bits    int
+	Seconds int
+}
+
+func (d dimension) Mul(other dimension) dimension {
+	return dimension{d.Bits + other.Bits, d.Seconds + other.Seconds}
+}
+
+func (d dimension) Div(other dimension) dimension {
+	return dimension{d.Bits - other.Bits, d.Seconds - other.Seconds}
+}
+
+func (d dimension) String() string {
+	switch d {
+	case dimension{}:
+		return "dimensionless"
+	case dimension{Bits: 1}:
+		return "information"
+	case dimension{Seconds: 1}:
+		return "time"
+	case dimension{Bits: 1, Seconds: -1}:
+		return "data rate"
+	default:
+		return d.baseUnitName()
+	}
+}
+
+// baseUnitName returns the name of the combination of base units that has
+// this dimension, like "bit/s".
+func (d dimension) baseUnitName() string {
+	var num, den []string
+	for _, part := range []struct {
+		name string
+		exp  int
+	}{{"bit", d.Bits}, {"s", d.Seconds}} {
+		switch {
+		case part.exp == 1:
+			num = append(num, part.name)
+		case part.exp > 1:
+			num = append(num, fmt.Sprintf("%s^%d", part.name, part.exp))
+		case part.exp == -1:
+			den = append(den, part.name)
+		case part.exp < -1:
+			den = append(den, fmt.Sprintf("%s^%d", part.name, -part.exp))
+		}
+	}
+	name := strings.Join(num, "*")
+	if name == "" {
+		name = "1"
+	}
+	if len(den) > 0 {
+		name += "/" + strings.Join(den, "/")
+	}
+	return name
+}
+
+// unit is a unit of measure, with its size given in the base units of its
+// dimension.
+type unit struct {
+	Name   string
+	Factor *big.Float
+	Dim    dimension
+}
+
+// preferredUnits are the units used for the results of multiplication and
+// division, whose units can't be derived from the operands.
+var preferredUnits = map[dimension]string{
+	{Bits: 1}:              "B",
+	{Seconds: 1}:           "s",
+	{Bits: 1, Seconds: -1}: "bps",
+}
+
+var units = map[string]unit{}
+
+func init() {
+	defineUnit := func(name string, factor *big.Float, dim dimension) {
+		units[name] = unit{Name: name, Factor: factor, Dim: dim}
+	}
+	info := dimension{Bits: 1}
+	rate := dimension{Bits: 1, Seconds: -1}
+	pow := func(base int64, exp int) *big.Float {
+		ret := new(big.Int).Exp(big.NewInt(base), big.NewInt(int64(exp)), nil)
+		return new(big.Float).SetPrec(512).SetInt(ret)
+	}
+
+	defineUnit("bit", pow(2, 0), info)
+	defineUnit("b", pow(2, 0), info)
+	defineUnit("B", pow(2, 3), info)
+	defineUnit("bps", pow(2, 0), rate)
+	for i, prefix := range []string{"k", "M", "G", "T", "P", "E"} {
+		si := pow(1000, i+1)
+		defineUnit(prefix+"b", si, info)
+		defineUnit(prefix+"bit", si, info)
+		defineUnit(prefix+"B", new(big.Float).Mul(si, pow(2, 3)), info)
+		defineUnit(prefix+"bps", si, rate)
+
+		iec := pow(1024, i+1)
+		prefix = strings.ToUpper(prefix) + "i"
+		defineUnit(prefix+"b", iec, info)
+		defineUnit(prefix+"bit", iec, info)
+		defineUnit(prefix+"B", new(big.Float).Mul(iec, pow(2, 3)), info)
+	}
+	// "K" is a common alternative spelling of the SI kilo prefix.
+	defineUnit("KB", units["kB"].Factor, info)
+	defineUnit("Kb", units["kb"].Factor, info)
+	defineUnit("Kbps", units["kbps"].Factor, rate)
+
+	secs := dimension{Seconds: 1}
+	defineUnit("ns", new(big.Float).Quo(pow(1000, 0), pow(1000, 3)), secs)
+	defineUnit("us", new(big.Float).Quo(pow(1000, 0), pow(1000, 2)), secs)
+	defineUnit("ms", new(big.Float).Quo(pow(1000, 0), pow(1000, 1)), secs)
+	defineUnit("s", pow(60, 0), secs)
+	defineUnit("min", pow(60, 1), secs)
+	defineUnit("h", pow(60, 2), secs)
+	defineUnit("d", new(big.Float).Mul(pow(60, 2), pow(24, 1)), secs)
+	defineUnit("w", new(big.Float).Mul(pow(60, 2), pow(24*7, 1)), secs)
+}
+
+// lookupUnit finds the unit with the given name. In addition to the units
+// in the table, rates can be written as an information unit divided by a
+// time unit, like "MB/s".
+func lookupUnit(name string) (unit, error) {
+	if u, ok := units[name]; ok {
+		return u, nil
+	}
+	if slash := strings.IndexByte(name, '/'); slash != -1 {
+		num, numOk := units[name[:slash]]
+		den, denOk := units[name[slash+1:]]
+		if numOk && denOk {
+			return unit{
+				Name:   name,
+				Factor: new(big.Float).Quo(num.Factor, den.Factor),
+				Dim:    num.Dim.Div(den.Dim),
+			}, nil
+		}
+	}
+	return unit{}, fmt.Errorf("unknown unit %q", name)
+}
+
+// NewQuantity returns a quantity of the given amount of the given unit.
+func NewQuantity(amount *big.Float, unitName string) (Quantity, error) {
+	u, err := lookupUnit(unitName)
+	if err != nil {
+		return Quantity{}, err
+	}
+	return Quantity{
+		base: new(big.Float).Mul(amount, u.Factor),
+		dim:  u.Dim,
+		unit: u,
+	}, nil
+}
+
+var quantityPattern = regexp.MustCompile(`^\s*([-+]?(?:[0-9]+\.?[0-9]*|\.[0-9]+)(?:[eE][-+]?[0-9]+)?)\s*(\S+)\s*$`)
+
+// ParseQuantity parses a string like "512 MiB" as a quantity.
+func ParseQuantity(s string) (Quantity, error) {
+	match := quantityPattern.FindStringSubmatch(s)
+	if match == nil {
+		return Quantity{}, fmt.Errorf("%q is not a quantity: must be a number followed by a unit, like \"512 MiB\"", s)
+	}
+	amount, _, err := big.ParseFloat(match[1], 10, 512, big.ToNearestEven)
+	if err != nil {
+		return Quantity{}, err
+	}
+	return NewQuantity(amount, match[2])
+}
+
+// Amount returns the magnitude of the quantity in its unit.
+func (q Quantity) Amount() *big.Float {
+	return new(big.Float).Quo(q.base, q.unit.Factor)
+}
+
+// Convert returns the same quantity presented in a different unit, which
+// must have the same dimension.
+func (q Quantity) Convert(unitName string) (Quantity, error) {
+	u, err := lookupUnit(unitName)
+	if err != nil {
+		return Quantity{}, err
+	}
+	if u.Dim != q.dim {
+		return Quantity{}, fmt.Errorf("cannot convert %s to %s: %s is a unit of %s", q.dim, unitName, unitName, u.Dim)
+	}
+	q.unit = u
+	return q, nil
+}
+
+func (q Quantity) String() string {
+	return fmt.Sprintf("%s %s", formatAmount(q.Amount()), q.unit.Name)
+}
+
+// MarshalJSON serializes the quantity as a string in the same format
+// accepted by ParseQuantity, which allows values containing quantities to
+// be JSON-encoded.
+func (q Quantity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(q.String())
+}
+
+// QuantityString returns the string representation of the given value if it
+// is a known quantity.
+func QuantityString(val cty.Value) (string, bool) {
+	if !val.IsKnown() || val.IsNull() || !val.Type().Equals(QuantityType) {
+		return "", false
+	}
+	return val.EncapsulatedValue().(*Quantity).String(), true
+}
+
+func formatAmount(amount *big.Float) string {
+	if amount.IsInt() {
+		return amount.Text('f', 0)
+	}
+	f, _ := amount.Float64()
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func quantityVal(q Quantity) cty.Value {
+	return cty.CapsuleVal(QuantityType, &q)
+}
+
+// quantityResult returns the given quantity as a value, unless it is
+// dimensionless in which case it is returned as a plain number.
+func quantityResult(q Quantity) cty.Value {
+	if q.dim == (dimension{}) {
+		return cty.NumberVal(q.base)
+	}
+	return quantityVal(q)
+}
+
+// quantityArg returns the given argument as a quantity, treating plain
+// numbers as dimensionless quantities.
+func quantityArg(val cty.Value, argIdx int) (Quantity, error) {
+	switch {
+	case val.Type() == cty.Number:
+		return Quantity{
+			base: val.AsBigFloat(),
+			unit: unit{Factor: big.NewFloat(1)},
+		}, nil
+	case val.Type().Equals(QuantityType):
+		return *val.EncapsulatedValue().(*Quantity), nil
+	default:
+		return Quantity{}, function.NewArgErrorf(argIdx, "must be a number or a quantity")
+	}
+}
+
+// withDerivedUnit returns the given quantity presented in the preferred
+// unit for its dimension, or in base units if there is no preferred unit.
+func withDerivedUnit(q Quantity) Quantity {
+	if name, ok := preferredUnits[q.dim]; ok {
+		q.unit = units[name]
+		return q
+	}
+	q.unit = unit{
+		Name:   q.dim.baseUnitName(),
+		Factor: big.NewFloat(1),
+		Dim:    q.dim,
+	}
+	return q
+}
+
+var quantityFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "amount",
+			Type: cty.DynamicPseudoType,
+		},
+	},
+	VarParam: &function.Parameter{
+		Name: "unit",
+		Type: cty.String,
+	},
+	Type: function.StaticReturnType(QuantityType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		var q Quantity
+		var err error
+		switch {
+		case len(args) > 2:
+			return cty.UnknownVal(QuantityType), function.NewArgErrorf(2, "too many arguments")
+		case len(args) == 2:
+			amount, convErr := convert.Convert(args[0], cty.Number)
+			if convErr != nil {
+				return cty.UnknownVal(QuantityType), function.NewArgErrorf(0, "must be a number when a unit is given")
+			}
+			q, err = NewQuantity(amount.AsBigFloat(), args[1].AsString())
+			if err != nil {
+				return cty.UnknownVal(QuantityType), function.NewArgError(1, err)
+			}
+		default:
+			str, convErr := convert.Convert(args[0], cty.String)
+			if convErr != nil {
+				return cty.UnknownVal(QuantityType), function.NewArgErrorf(0, "must be a string like \"512 MiB\"")
+			}
+			q, err = ParseQuantity(str.AsString())
+			if err != nil {
+				return cty.UnknownVal(QuantityType), function.NewArgError(0, err)
+			}
+		}
+		return quantityVal(q), nil
+	},
+})
+
+var convertUnitFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "quantity",
+			Type: QuantityType,
+		},
+		{
+			Name: "unit",
+			Type: cty.String,
+		},
+	},
+	Type: function.StaticReturnType(QuantityType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		q := *args[0].EncapsulatedValue().(*Quantity)
+		converted, err := q.Convert(args[1].AsString())
+		if err != nil {
+			return cty.UnknownVal(QuantityType), function.NewArgError(1, err)
+		}
+		return quantityVal(converted), nil
+	},
+})
+
+var quantityValueFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{
+			Name: "quantity",
+			Type: QuantityType,
+		},
+	},
+	VarParam: &function.Parameter{
+		Name: "unit",
+		Type: cty.String,
+	},
+	Type: function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		q := *args[0].EncapsulatedValue().(*Quantity)
+		switch {
+		case len(args) > 2:
+			return cty.UnknownVal(cty.Number), function.NewArgErrorf(2, "too many arguments")
+		case len(args) == 2:
+			var err error
+			q, err = q.Convert(args[1].AsString())
+			if err != nil {
+				return cty.UnknownVal(cty.Number), function.NewArgError(1, err)
+			}
+		}
+		return cty.NumberVal(q.Amount()), nil
+	},
+})
+
+// quantitySumFunc builds a function that adds or subtracts quantities of the
+// same dimension, giving a result in the unit of the first argument.
+func quantitySumFunc(op func(a, b *big.Float) *big.Float) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "a",
+				Type: cty.DynamicPseudoType,
+			},
+		},
+		VarParam: &function.Parameter{
+			Name: "b",
+			Type: cty.DynamicPseudoType,
+		},
+		Type: function.StaticReturnType(cty.DynamicPseudoType),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			result, err := quantityArg(args[0], 0)
+			if err != nil {
+				return cty.DynamicVal, err
+			}
+			for i, arg := range args[1:] {
+				q, err := quantityArg(arg, i+1)
+				if err != nil {
+					return cty.DynamicVal, err
+				}
+				if q.dim != result.dim {
+					return cty.DynamicVal, function.NewArgErrorf(i+1, "cannot combine %s with %s", q.dim, result.dim)
+				}
+				result.base = op(result.base, q.base)
+			}
+			return quantityResult(result), nil
+		},
+	})
+}
+
+// quantityProductFunc builds a function that multiplies or divides two
+// quantities, giving a result whose dimension is derived from both.
+func quantityProductFunc(divide bool) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "a",
+				Type: cty.DynamicPseudoType,
+			},
+			{
+				Name: "b",
+				Type: cty.DynamicPseudoType,
+			},
+		},
+		Type: function.StaticReturnType(cty.DynamicPseudoType),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			a, err := quantityArg(args[0], 0)
+			if err != nil {
+				return cty.DynamicVal, err
+			}
+			b, err := quantityArg(args[1], 1)
+			if err != nil {
+				return cty.DynamicVal, err
+			}
+
+			var result Quantity
+			if divide {
+				if b.base.Sign() == 0 {
+					return cty.DynamicVal, function.NewArgErrorf(1, "cannot divide by zero")
+				}
+				result.base = new(big.Float).Quo(a.base, b.base)
+				result.dim = a.dim.Div(b.dim)
+			} else {
+				result.base = new(big.Float).Mul(a.base, b.base)
+				result.dim = a.dim.Mul(b.dim)
+			}
+
+			switch {
+			case b.dim == (dimension{}):
+				// Scaling by a plain number retains the unit.
+				result.unit = a.unit
+			case a.dim == (dimension{}) && result.dim == b.dim:
+				result.unit = b.unit
+			default:
+				result = withDerivedUnit(result)
+			}
+			return quantityResult(result), nil
+		},
+	})
+}
+
+var quantityAddFunc = quantitySumFunc(func(a, b *big.Float) *big.Float {
+	return new(big.Float).Add(a, b)
+})
+
+var quantitySubtractFunc = quantitySumFunc(func(a, b *big.Float) *big.Float {
+	return new(big.Float).Sub(a, b)
+})
+
+var quantityMultiplyFunc = quantityProductFunc(false)
+
+var quantityDivideFunc = quantityProductFunc(true)
@@ -0,0 +1,239 @@
+package calc
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/hcl2/ext/typeexpr"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// rewriteExpression transforms the given expression in-place to implement
+// the few calculator features that can't be implemented as normal
+// functions, because they need to see the arguments of a function call
+// before they are evaluated or need to know where they were called from.
+// It returns the expression to use in place of the given one, which may be
+// the same expression. The source code the expression was parsed from is
+// used to identify call sites.
+//
+// Calls to these functions with the wrong number of arguments are reported
+// in the returned diagnostics and left alone, since the rewriting would add
+// hidden arguments that would confuse the errors from evaluating them.
+func rewriteExpression(expr hclsyntax.Expression, src []byte) (hclsyntax.Expression, hcl.Diagnostics) {
+	r := &rewriter{src: src}
+	expr = r.rewrite(expr)
+	return expr, r.diags
+}
+
+// rewrittenParams are the parameters of the functions whose calls have
+// arguments added by rewriteExpression, as they are written by the user.
+var rewrittenParams = map[string]struct {
+	names    []string
+	variadic bool
+}{
+	"can":     {names: []string{"expr"}},
+	"try":     {names: []string{"exprs"}, variadic: true},
+	"random":  {names: []string{"min", "max"}},
+	"shuffle": {names: []string{"list"}},
+	"sample":  {names: []string{"list", "n"}},
+	"uuid":    {},
+}
+
+// ReservedFunc returns true if the given name is reserved for a builtin
+// function whose calls are transformed when expressions are parsed. Since
+// that happens before it's known which function a call refers to, these
+// names cannot be used for any other function, whether or not the table's
+// profile has the builtin function.
+func ReservedFunc(name string) bool {
+	_, rewritten := rewrittenParams[name]
+	return rewritten || name == "convert"
+}
+
+// reservedFuncDiags returns the diagnostics for an attempt to define a
+// function with a reserved name.
+func reservedFuncDiags(name string) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	diags = append(diags, &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Reserved function name",
+		Detail:   fmt.Sprintf("The name %q is reserved for a builtin function, so cannot be used for another function.", name),
+	})
+	return diags
+}
+
+// arityDiags checks the number of arguments given in a call to one of the
+// functions with hidden arguments, returning diagnostics like those from
+// evaluating the call but in terms of the parameters the user can see.
+func arityDiags(call *hclsyntax.FunctionCallExpr) hcl.Diagnostics {
+	params, rewritten := rewrittenParams[call.Name]
+	if !rewritten {
+		return nil
+	}
+	if call.ExpandFinal {
+		// We can't tell how many arguments an expansion will produce.
+		return nil
+	}
+
+	var diags hcl.Diagnostics
+	switch {
+	case len(call.Args) < len(params.names):
+		qual := ""
+		if params.variadic {
+			qual = " at least"
+		}
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Not enough function arguments",
+			Detail:   fmt.Sprintf("Function %q expects%s %d argument(s). Missing value for %q.", call.Name, qual, len(params.names), params.names[len(call.Args)]),
+			Subject:  call.CloseParenRange.Ptr(),
+			Context:  call.Range().Ptr(),
+		})
+	case !params.variadic && len(call.Args) > len(params.names):
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Too many function arguments",
+			Detail:   fmt.Sprintf("Function %q expects only %d argument(s).", call.Name, len(params.names)),
+			Subject:  call.Args[len(params.names)].StartRange().Ptr(),
+			Context:  call.Range().Ptr(),
+		})
+	}
+	return diags
+}
+
+type rewriter struct {
+	src   []byte
+	diags hcl.Diagnostics
+
+	// locals is a stack of the names of the local variables declared by
+	// the for expressions enclosing the node currently being transformed.
+	locals []map[string]struct{}
+}
+
+func (r *rewriter) rewrite(expr hclsyntax.Expression) hclsyntax.Expression {
+	newExpr, _ := hclsyntax.Transform(expr, r)
+	return newExpr.(hclsyntax.Expression)
+}
+
+func (r *rewriter) Transform(node hclsyntax.Node) (hclsyntax.Node, bool, hcl.Diagnostics) {
+	if scope, ok := node.(hclsyntax.ChildScope); ok {
+		r.locals = append(r.locals, scope.LocalNames)
+		return node, true, nil
+	}
+
+	call, ok := node.(*hclsyntax.FunctionCallExpr)
+	if !ok {
+		return node, true, nil
+	}
+	if diags := arityDiags(call); diags.HasErrors() {
+		r.diags = append(r.diags, diags...)
+		return call, true, nil
+	}
+
+	switch call.Name {
+	case "convert":
+		// The second argument of convert is a type expression, which we'll
+		// replace with a literal type value. Anything that isn't a valid
+		// type expression is left alone, so that convert reports it.
+		if len(call.Args) == 2 && !call.ExpandFinal {
+			ty, diags := typeexpr.TypeConstraint(call.Args[1])
+			if !diags.HasErrors() {
+				call.Args[1] = &hclsyntax.LiteralValueExpr{
+					Val:      typeVal(ty),
+					SrcRange: call.Args[1].Range(),
+				}
+			}
+		}
+
+	case "can", "try":
+		if call.ExpandFinal {
+			break
+		}
+		// The argument expressions are wrapped up to be evaluated by the
+		// function itself, along with the values of all of the variables
+		// they refer to. See funcs_try.go for more details.
+		var names []string
+		rngs := map[string]hcl.Range{}
+		args := make([]hclsyntax.Expression, 0, len(call.Args)+1)
+		args = append(args, nil) // placeholder for the variables object
+		for _, arg := range call.Args {
+			arg = r.rewrite(arg)
+			for _, traversal := range hclsyntax.Variables(arg) {
+				name := traversal.RootName()
+				if _, seen := rngs[name]; !seen {
+					rngs[name] = traversal.SourceRange()
+					names = append(names, name)
+				}
+			}
+			args = append(args, &hclsyntax.LiteralValueExpr{
+				Val:      exprVal(arg),
+				SrcRange: arg.Range(),
+			})
+		}
+		args[0] = variablesObjectExpr(names, rngs, call.OpenParenRange)
+		call.Args = args
+
+		// The arguments are already rewritten, so we don't descend.
+		return call, false, nil
+
+	case "random", "shuffle", "sample", "uuid":
+		// Each call is given an identifier for its call site and the
+		// values of any local variables in scope, which together seed its
+		// generator. See funcs_random.go for more details.
+		var names []string
+		for _, scope := range r.locals {
+			for name := range scope {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		site := &hclsyntax.LiteralValueExpr{
+			Val:      cty.StringVal(call.Range().String() + "\x00" + string(r.src)),
+			SrcRange: call.OpenParenRange,
+		}
+		call.Args = append([]hclsyntax.Expression{site, variablesObjectExpr(names, nil, call.OpenParenRange)}, call.Args...)
+	}
+	return call, true, nil
+}
+
+// variablesObjectExpr returns an expression that constructs an object whose
+// attributes are the values of the variables with the given names. Each
+// reference to a variable has its range from rngs, so that diagnostics about
+// it point at where the original expression refers to it, or else the
+// range of the object itself.
+func variablesObjectExpr(names []string, rngs map[string]hcl.Range, rng hcl.Range) hclsyntax.Expression {
+	items := make([]hclsyntax.ObjectConsItem, len(names))
+	for i, name := range names {
+		varRng, ok := rngs[name]
+		if !ok {
+			varRng = rng
+		}
+		items[i] = hclsyntax.ObjectConsItem{
+			KeyExpr: &hclsyntax.LiteralValueExpr{
+				Val:      cty.StringVal(name),
+				SrcRange: varRng,
+			},
+			ValueExpr: &hclsyntax.ScopeTraversalExpr{
+				Traversal: hcl.Traversal{
+					hcl.TraverseRoot{
+						Name:     name,
+						SrcRange: varRng,
+					},
+				},
+				SrcRange: varRng,
+			},
+		}
+	}
+	return &hclsyntax.ObjectConsExpr{
+		Items:    items,
+		SrcRange: rng,
+	}
+}
+
+func (r *rewriter) TransformExit(node hclsyntax.Node) hcl.Diagnostics {
+	if _, ok := node.(hclsyntax.ChildScope); ok {
+		r.locals = r.locals[:len(r.locals)-1]
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package calc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// maxSuggestions is the largest number of names suggested for an unknown
+// name.
+const maxSuggestions = 3
+
+// suggestNames returns the names from the given candidates that are close
+// to the given unknown name, best first, as a sentence to add to the
+// detail of a diagnostic, or an empty string if there are none.
+//
+// A candidate is close if it differs only in case, if it is within a few
+// edits of the name, or if either is a prefix of the other, ignoring case.
+// Prefixes are only considered for names of at least three characters, and
+// are ranked below the others.
+func suggestNames(given string, candidates symbolSet) string {
+	type suggestion struct {
+		name  string
+		score int
+	}
+
+	lower := strings.ToLower(given)
+	maxDist := len(given) / 4
+	if maxDist < 2 {
+		maxDist = 2
+	}
+	if maxDist >= len(given) {
+		maxDist = len(given) - 1
+	}
+
+	var found []suggestion
+	for name := range candidates {
+		if name == given {
+			continue
+		}
+		candidate := strings.ToLower(name)
+		diff := len(candidate) - len(lower)
+		if diff < 0 {
+			diff = -diff
+		}
+
+		if diff <= maxDist {
+			if dist := editDistance(lower, candidate); dist <= maxDist {
+				found = append(found, suggestion{name, dist})
+				continue
+			}
+		}
+		if len(lower) >= 3 && len(candidate) >= 3 && (strings.HasPrefix(candidate, lower) || strings.HasPrefix(lower, candidate)) {
+			found = append(found, suggestion{name, maxDist + 1})
+		}
+	}
+	if len(found) == 0 {
+		return ""
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].score != found[j].score {
+			return found[i].score < found[j].score
+		}
+		return found[i].name < found[j].name
+	})
+	if len(found) > maxSuggestions {
+		found = found[:maxSuggestions]
+	}
+
+	quoted := make([]string, len(found))
+	for i, s := range found {
+		quoted[i] = fmt.Sprintf("%q", s.name)
+	}
+	if len(quoted) == 1 {
+		return fmt.Sprintf(" Did you mean %s?", quoted[0])
+	}
+	last := len(quoted) - 1
+	return fmt.Sprintf(" Did you mean %s or %s?", strings.Join(quoted[:last], ", "), quoted[last])
+}
+
+// editDistance returns the Levenshtein distance between the given strings,
+// which is the number of single-character insertions, deletions and
+// substitutions needed to turn one into the other.
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	cur := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		cur[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(br)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// symbolSuggestions returns suggestions for a reference to the undefined
+// symbol with the given name, from the defined symbols and the given extra
+// variables.
+func (t *Table) symbolSuggestions(name string, extraVars map[string]cty.Value) string {
+	candidates := make(symbolSet, len(t.syms)+len(extraVars))
+	for candidate := range t.syms {
+		candidates.Add(candidate)
+	}
+	for candidate := range extraVars {
+		candidates.Add(candidate)
+	}
+	return suggestNames(name, candidates)
+}
+
+// suggestFuncs replaces the suggestions on any diagnostics about calls to
+// unknown functions in the given expression with suggestions from all of
+// the functions available in the given context. The expression evaluator
+// only suggests functions from the innermost context, which has only the
+// user-defined functions.
+func suggestFuncs(diags hcl.Diagnostics, expr Expression, ctx *hcl.EvalContext) {
+	var candidates symbolSet
+	for _, diag := range diags {
+		if diag.Summary != "Call to unknown function" || diag.Subject == nil || diag.Subject.Filename != expr.Range().Filename {
+			continue
+		}
+		name := string(diag.Subject.SliceBytes(expr.Source))
+		if !hclsyntax.ValidIdentifier(name) {
+			continue
+		}
+
+		if candidates == nil {
+			candidates = newSymbolSet()
+			for c := ctx; c != nil; c = c.Parent() {
+				for candidate := range c.Functions {
+					candidates.Add(candidate)
+				}
+			}
+		}
+		diag.Detail = fmt.Sprintf("There is no function named %q.%s", name, suggestNames(name, candidates))
+	}
+}
@@ -10,6 +10,12 @@ func newSymbolSet() symbolSet {
 	return map[string]setEntry{}
 }
 
+func (s symbolSet) Copy() symbolSet {
+	ret := make(symbolSet, len(s))
+	ret.AddAll(s)
+	return ret
+}
+
 func (s symbolSet) Add(name string) {
 	s[name] = setEntry{}
 }
@@ -1,9 +1,15 @@
 package calc
 
 import (
+	"container/heap"
+	"context"
 	"fmt"
+	"math/rand"
+	"os"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/hcl2/hcl"
 	"github.com/hashicorp/hcl2/hcl/hclsyntax"
@@ -11,33 +17,420 @@ import (
 	"github.com/zclconf/go-cty/cty/function"
 )
 
+// A Table is a set of symbols defined by expressions, along with the
+// functions those expressions may call.
+//
+// A table is safe for concurrent use. Each evaluation holds a read lock on
+// the table until it completes, so it sees a consistent set of definitions,
+// and changes wait for any evaluations in progress. Snapshot takes a copy
+// of the table for callers that need several evaluations to see the same
+// definitions.
 type Table struct {
-	syms   map[string]Expression
-	funcs  map[string]function.Function
-	all    symbolSet
-	reqs   edgeSet
-	reqdBy edgeSet
+	// mu protects all of the other fields. Evaluations run against a view
+	// of the table, which shares its fields and is only used while a read
+	// lock is held.
+	mu sync.RWMutex
+
+	syms     map[string]Expression
+	funcDefs map[string]*funcDef
+	all      symbolSet
+	reqs     edgeSet
+	reqdBy   edgeSet
+
+	// names indexes the names of the defined symbols, and callers maps the
+	// name of each function to the symbols that call it, except for the
+	// opaque symbols whose function calls are unknown.
+	names   *nameIndex
+	callers edgeSet
+	opaque  symbolSet
+
+	// builtins provides the functions of the table's profile and funcs
+	// provides its user-defined functions. These are only populated in
+	// views, since the functions are bound to the table they are built
+	// for. See profiles.go for more details.
+	builtins *hcl.EvalContext
+	funcs    map[string]function.Function
+	profile  string
+	clock    func() time.Time
+	seed     int64
+	baseDir  string
+
+	// env is the set of environment variables that may be read, and
+	// readOnly is the set of symbols that cannot be redefined, which
+	// includes a symbol for each of those variables.
+	env      symbolSet
+	readOnly symbolSet
+
+	// hostFuncs and hidden are the functions added to and removed from
+	// the table's profile by the program embedding the calculator, and
+	// impure is the set of functions that may return different results
+	// for the same arguments. These are fixed once the table is created,
+	// so snapshots and views share them.
+	hostFuncs map[string]function.Function
+	hidden    symbolSet
+	impure    symbolSet
+
+	// limits bounds the resources used by each evaluation, and active is
+	// the guard enforcing them for the evaluation in progress, if any.
+	// See limits.go for more details.
+	limits Limits
+	active *guard
+
+	// cache holds the values of symbols from previous evaluations, and
+	// purity records which symbols' values can be cached during the
+	// evaluation of a view. See cache.go for more details.
+	cache    *valueCache
+	purityMu sync.Mutex
+	purity   map[string]bool
+
+	// parallelism is the largest number of symbols that an evaluation may
+	// evaluate at the same time. See parallel.go for more details.
+	parallelism int
+
+	// refuseCycles causes Define and Batch.Commit to reject changes that
+	// would create a dependency cycle. See cycles.go for more details.
+	refuseCycles bool
 }
 
-func NewTable() *Table {
-	return &Table{
-		syms:   make(map[string]Expression),
-		funcs:  make(map[string]function.Function),
-		all:    make(symbolSet),
-		reqs:   make(edgeSet),
-		reqdBy: make(edgeSet),
+// NewTable creates a new, empty table customized by the given options.
+//
+// The functions whose calls are rewritten when expressions are parsed,
+// such as try and random, can't be replaced by options, since calls to
+// them are rewritten whichever function the name refers to. See
+// ReservedFunc.
+func NewTable(opts ...Option) *Table {
+	t := &Table{
+		syms:      make(map[string]Expression),
+		funcDefs:  make(map[string]*funcDef),
+		all:       make(symbolSet),
+		reqs:      make(edgeSet),
+		reqdBy:    make(edgeSet),
+		names:     newNameIndex(),
+		callers:   make(edgeSet),
+		opaque:    make(symbolSet),
+		profile:   DefaultProfile,
+		clock:     time.Now,
+		baseDir:   ".",
+		env:       make(symbolSet),
+		readOnly:  make(symbolSet),
+		hostFuncs: make(map[string]function.Function),
+		hidden:    make(symbolSet),
+		impure:    make(symbolSet),
+		limits:    DefaultLimits,
+		cache:     newValueCache(),
+
+		parallelism: defaultParallelism(),
 	}
+	for _, name := range impureFuncs {
+		t.impure.Add(name)
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Snapshot returns a copy of the table as it is now, which is unaffected by
+// later changes to the table and vice-versa.
+func (t *Table) Snapshot() *Table {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	s := &Table{
+		syms:      make(map[string]Expression, len(t.syms)),
+		funcDefs:  make(map[string]*funcDef, len(t.funcDefs)),
+		all:       t.all.Copy(),
+		reqs:      t.reqs.Copy(),
+		reqdBy:    t.reqdBy.Copy(),
+		names:     newNameIndex(),
+		callers:   t.callers.Copy(),
+		opaque:    t.opaque.Copy(),
+		profile:   t.profile,
+		clock:     t.clock,
+		seed:      t.seed,
+		baseDir:   t.baseDir,
+		env:       t.env.Copy(),
+		readOnly:  t.readOnly.Copy(),
+		hostFuncs: t.hostFuncs,
+		hidden:    t.hidden,
+		impure:    t.impure,
+		limits:    t.limits,
+		cache:     newValueCache(),
+
+		parallelism:  t.parallelism,
+		refuseCycles: t.refuseCycles,
+	}
+	for name, expr := range t.syms {
+		s.syms[name] = expr
+		s.names.Add(name)
+	}
+	for name, def := range t.funcDefs {
+		s.funcDefs[name] = def
+	}
+	return s
+}
+
+// view returns a table for a single evaluation of this one, which shares
+// its definitions but has its own functions bound to it. The caller must
+// hold a read lock on this table until the evaluation is complete.
+func (t *Table) view() *Table {
+	v := &Table{
+		syms:      t.syms,
+		funcDefs:  t.funcDefs,
+		all:       t.all,
+		reqs:      t.reqs,
+		reqdBy:    t.reqdBy,
+		names:     t.names,
+		callers:   t.callers,
+		opaque:    t.opaque,
+		builtins:  &hcl.EvalContext{},
+		funcs:     make(map[string]function.Function, len(t.funcDefs)),
+		profile:   t.profile,
+		clock:     t.clock,
+		seed:      t.seed,
+		baseDir:   t.baseDir,
+		env:       t.env,
+		readOnly:  t.readOnly,
+		hostFuncs: t.hostFuncs,
+		hidden:    t.hidden,
+		impure:    t.impure,
+		limits:    t.limits,
+		cache:     t.cache,
+		purity:    make(map[string]bool),
+
+		parallelism: t.parallelism,
+	}
+	for name, def := range t.funcDefs {
+		v.funcs[name] = v.userFunc(name, def)
+	}
+	v.builtins.Functions = v.guardFuncs(v.profileFuncs())
+	return v
+}
+
+// SetClock changes the function the table uses to find the current time,
+// which is the real time by default. This is primarily intended to allow
+// a fixed time to be used so that results are reproducible.
+func (t *Table) SetClock(now func() time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clock = now
+}
+
+// FixedClock returns a clock function for use with SetClock that always
+// returns the given time.
+func FixedClock(now time.Time) func() time.Time {
+	return func() time.Time {
+		return now
+	}
+}
+
+func (t *Table) now() time.Time {
+	return t.clock()
+}
+
+// SetSeed changes the seed for the table's pseudo-random functions, which
+// is zero by default. The results of those functions are determined
+// entirely by the seed and the expressions that call them, so a particular
+// seed always produces the same results for the same definitions.
+func (t *Table) SetSeed(seed int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seed = seed
+	t.cache.clear()
+}
+
+// Seed returns the seed for the table's pseudo-random functions.
+func (t *Table) Seed() int64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.seed
+}
+
+func (t *Table) rand(site string, locals cty.Value) *rand.Rand {
+	return seededRand(t.seed, site, locals)
+}
+
+// SetBaseDir changes the directory that the file functions are restricted
+// to, which is the current working directory by default. Relative paths
+// given to those functions are interpreted relative to this directory.
+func (t *Table) SetBaseDir(dir string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.baseDir = dir
+}
+
+// BaseDir returns the directory that the file functions are restricted to.
+func (t *Table) BaseDir() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.baseDir
+}
+
+func (t *Table) resolvePath(path string) (string, error) {
+	return sandboxPath(t.baseDir, path)
+}
+
+// AllowEnv allows the environment variables with the given names to be read
+// using the env function, in the profiles that have it, and defines a
+// read-only symbol of the same name for each of them whose value is the
+// value of the variable, or null if it isn't set, whatever the profile. No
+// environment variables may be read by default.
+func (t *Table) AllowEnv(names ...string) hcl.Diagnostics {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var diags hcl.Diagnostics
+	for _, name := range names {
+		if !hclsyntax.ValidIdentifier(name) {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid environment variable name",
+				Detail:   fmt.Sprintf("Cannot allow %q, because it is not a valid symbol name.", name),
+			})
+			continue
+		}
+
+		// The source is what the user would write to get the same value,
+		// but the symbol doesn't depend on the env function being
+		// available. See envVarExpr.
+		src := []byte(fmt.Sprintf("env(%q, null)", name))
+		expr := Expression{
+			Expression: envVarExpr{
+				name: name,
+				rng: hcl.Range{
+					Filename: name,
+					Start:    hcl.Pos{Line: 1, Column: 1},
+					End:      hcl.Pos{Line: 1, Column: len(src) + 1, Byte: len(src)},
+				},
+			},
+			Source: src,
+		}
+		t.env.Add(name)
+		t.define(name, expr)
+		t.readOnly.Add(name)
+	}
+	return diags
+}
+
+// EnvNames returns the names of the environment variables that may be read,
+// in lexicographical order.
+func (t *Table) EnvNames() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.env.AppendNames(nil)
+}
+
+func (t *Table) lookupEnv(name string) (string, bool, error) {
+	if !t.env.Has(name) {
+		if t.env.Empty() {
+			return "", false, fmt.Errorf("reading environment variables is not allowed")
+		}
+		return "", false, fmt.Errorf("reading the environment variable %q is not allowed", name)
+	}
+	val, set := os.LookupEnv(name)
+	return val, set, nil
+}
+
+// ImpureFunc returns true if the function with the given name may return a
+// different result each time it is called with the same arguments.
+func (t *Table) ImpureFunc(name string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.impure.Has(name)
+}
+
+// ReadOnly returns true if the symbol with the given name cannot be
+// redefined or removed.
+func (t *Table) ReadOnly(name string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.readOnly.Has(name)
+}
+
+// deferredScope returns the context in which the expressions given to can
+// and try are evaluated.
+func (t *Table) deferredScope(vars map[string]cty.Value) *hcl.EvalContext {
+	ctx := t.builtins.NewChild()
+	ctx.Variables = vars
+	ctx.Functions = t.funcs
+	return ctx
+}
+
+// deferredFuncs returns the given functions along with versions of can and
+// try, if the profile has them, that evaluate their expressions in a child
+// of the given context. The functions that a user-defined function's body
+// sees in place of the table's own, such as the one refusing calls to
+// itself, then apply inside can and try too.
+func (t *Table) deferredFuncs(ctx *hcl.EvalContext, funcs map[string]function.Function) map[string]function.Function {
+	scope := func(vars map[string]cty.Value) *hcl.EvalContext {
+		child := ctx.NewChild()
+		child.Variables = vars
+		return child
+	}
+	ret := make(map[string]function.Function, len(funcs)+2)
+	for name, f := range funcs {
+		ret[name] = f
+	}
+	if _, ok := t.builtins.Functions["can"]; ok {
+		ret["can"] = t.guardFunc(canFunc(scope))
+	}
+	if _, ok := t.builtins.Functions["try"]; ok {
+		ret["try"] = t.guardFunc(tryFunc(scope))
+	}
+	return ret
 }
 
 func (t *Table) Source(name string) []byte {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.syms[name].Source
 }
 
-func (t *Table) Define(name string, expr Expression) {
+// Define assigns the given expression to the symbol with the given name,
+// replacing any existing definition. If the new definition creates a
+// dependency cycle then the returned diagnostics describe it, as warnings,
+// or as errors if the table refuses cycles, in which case the table is
+// left unchanged. See SetRefuseCycles.
+func (t *Table) Define(name string, expr Expression) hcl.Diagnostics {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.readOnly.Has(name) {
+		return readOnlyDiags(name)
+	}
+	prev, defined := t.syms[name]
+	t.define(name, expr)
+
+	path := t.cyclePath(name)
+	if path == nil {
+		return nil
+	}
+	if !t.refuseCycles {
+		return t.cycleDiags(path, hcl.DiagWarning)
+	}
+	diags := t.cycleDiags(path, hcl.DiagError)
+	if defined {
+		t.define(name, prev)
+	} else {
+		t.remove(name)
+	}
+	return diags
+}
+
+func (t *Table) define(name string, expr Expression) {
+	t.invalidateSymbol(name)
+
 	// Discard any existing symbol with the same name
 	t.remove(name)
 
+	expr = withVars(expr)
 	t.syms[name] = expr
+	t.names.Add(name)
+	if expr.calls == nil {
+		t.opaque.Add(name)
+	}
+	for funcName := range expr.calls {
+		t.callers.Add(funcName, name)
+	}
 	for _, traversal := range expr.Variables() {
 		reqdName := traversal.RootName()
 
@@ -48,11 +441,60 @@ func (t *Table) Define(name string, expr Expression) {
 	t.all.Add(name)
 }
 
-func (t *Table) Remove(name string) {
+func (t *Table) Remove(name string) hcl.Diagnostics {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.readOnly.Has(name) {
+		return readOnlyDiags(name)
+	}
+	t.invalidateSymbol(name)
 	t.remove(name)
+	return nil
 }
 
-func (t *Table) DefineFunc(name string, params []string, varParam bool, expr Expression) {
+func readOnlyDiags(name string) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	diags = append(diags, &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Read-only symbol",
+		Detail:   fmt.Sprintf("The symbol %q is read-only, so it cannot be redefined or removed.", name),
+	})
+	return diags
+}
+
+// funcDef is the definition of a user-defined function, from which a
+// function is built for each view of the table.
+type funcDef struct {
+	params   []string
+	varParam bool
+	expr     Expression
+}
+
+// DefineFunc defines a function with the given name, whose result is the
+// value of the given expression with the given parameters as variables. If
+// varParam is set then the last parameter collects any extra arguments into
+// a list. Names for which ReservedFunc returns true cannot be used.
+func (t *Table) DefineFunc(name string, params []string, varParam bool, expr Expression) hcl.Diagnostics {
+	if ReservedFunc(name) {
+		return reservedFuncDiags(name)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.defineFunc(name, &funcDef{
+		params:   params,
+		varParam: varParam,
+		expr:     withVars(expr),
+	})
+	return nil
+}
+
+func (t *Table) defineFunc(name string, def *funcDef) {
+	t.funcDefs[name] = def
+	t.invalidateFunc(name)
+}
+
+func (t *Table) userFunc(name string, def *funcDef) function.Function {
+	params, varParam, expr := def.params, def.varParam, def.expr
 	var varName string
 	if varParam {
 		params, varName = params[:len(params)-1], params[len(params)-1]
@@ -77,6 +519,10 @@ func (t *Table) DefineFunc(name string, params []string, varParam bool, expr Exp
 	}
 
 	impl := func(args []cty.Value) (cty.Value, error) {
+		if err := t.active.err(); err != nil {
+			return cty.DynamicVal, err
+		}
+
 		argVars := make(map[string]cty.Value)
 
 		// The cty function machinery guarantees that we have at least
@@ -89,7 +535,9 @@ func (t *Table) DefineFunc(name string, params []string, varParam bool, expr Exp
 			argVars[varName] = cty.TupleVal(varArgs)
 		}
 
-		result, diags := t.eval(expr, argVars, extraFuncs)
+		// The calling evaluation may already be using all of its
+		// goroutines, so the function's own evaluation uses only one.
+		result, diags := t.eval(expr, argVars, extraFuncs, 1)
 		if diags.HasErrors() {
 			// Smuggle the diagnostics out via the error channel, since
 			// a diagnostics sequence implements error. Caller can
@@ -106,42 +554,62 @@ func (t *Table) DefineFunc(name string, params []string, varParam bool, expr Exp
 	spec.Impl = func(args []cty.Value, retType cty.Type) (cty.Value, error) {
 		return impl(args)
 	}
-	t.funcs[name] = function.New(spec)
+	return function.New(spec)
 }
 
 func (t *Table) RemoveFunc(name string) {
-	delete(t.funcs, name)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.removeFunc(name)
+}
+
+func (t *Table) removeFunc(name string) {
+	delete(t.funcDefs, name)
+	t.invalidateFunc(name)
 }
 
 func (t *Table) remove(name string) {
-	delete(t.syms, name)
-	for reqdName := range t.reqs {
+	if expr, defined := t.syms[name]; defined {
+		delete(t.syms, name)
+		t.names.Remove(name)
+		t.opaque.Remove(name)
+		for funcName := range expr.calls {
+			t.callers.Remove(funcName, name)
+		}
+	}
+	for reqdName := range t.reqs.AllFrom(name) {
 		t.reqdBy.Remove(reqdName, name)
+		t.forgetIfUnused(reqdName)
 	}
 	t.reqs.RemoveFrom(name)
-	if !t.reqs.FromHasAny(name) && !t.reqdBy.FromHasAny(name) {
+	t.forgetIfUnused(name)
+}
+
+// forgetIfUnused removes the given name from the set of all symbols if it
+// is neither defined nor required by any other symbol.
+func (t *Table) forgetIfUnused(name string) {
+	if _, defined := t.syms[name]; !defined && !t.reqdBy.FromHasAny(name) {
 		t.all.Remove(name)
 	}
 }
 
 func (t *Table) visitSymbols(syms symbolSet, cb func(name string, expr Expression)) symbolSet {
-	queue := make([]string, 0, len(t.all))
-	inDeg := make(map[string]int, len(t.all))
+	ready := make(nameHeap, 0, len(syms))
+	inDeg := make(map[string]int, len(syms))
 
 	for name := range syms {
 		inDeg[name] = len(t.reqs.AllFrom(name))
 		if inDeg[name] == 0 {
-			queue = append(queue, name)
+			ready = append(ready, name)
 		}
 	}
 
-	// Sort the initial items so that we'll visit them in lexicographical order.
-	sort.Strings(queue)
+	// Of the symbols that are ready, we always visit the one that is first
+	// in lexicographical order.
+	heap.Init(&ready)
 
-	for len(queue) > 0 {
-		// dequeue next item
-		var name string
-		name, queue = queue[0], queue[1:]
+	for ready.Len() > 0 {
+		name := heap.Pop(&ready).(string)
 
 		expr, defined := t.syms[name]
 		if !defined {
@@ -149,16 +617,15 @@ func (t *Table) visitSymbols(syms symbolSet, cb func(name string, expr Expressio
 		}
 		cb(name, expr)
 
-		newQueueIdx := len(queue)
 		for newName := range t.reqdBy[name] {
+			if !syms.Has(newName) {
+				continue
+			}
 			inDeg[newName]--
-			if inDeg[newName] == 0 && syms.Has(newName) {
-				queue = append(queue, newName)
+			if inDeg[newName] == 0 {
+				heap.Push(&ready, newName)
 			}
 		}
-		// Sort the items we just queued so that we'll visit them in
-		// lexicographical order.
-		sort.Strings(queue[newQueueIdx:])
 	}
 
 	// If there's anything left in inDeg then we have a cycle. We'll return
@@ -173,54 +640,124 @@ func (t *Table) visitSymbols(syms symbolSet, cb func(name string, expr Expressio
 }
 
 func (t *Table) Value(name string) (cty.Value, hcl.Diagnostics) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	expr, defined := t.syms[name]
 	if !defined {
 		var diags hcl.Diagnostics
 		diags = append(diags, &hcl.Diagnostic{
 			Severity: hcl.DiagError,
 			Summary:  "Variable not defined",
-			Detail:   fmt.Sprintf("The variable %q has not yet had an expression assigned.", name),
+			Detail:   fmt.Sprintf("The variable %q has not yet had an expression assigned.%s", name, t.symbolSuggestions(name, nil)),
 		})
 		return cty.DynamicVal, diags
 	}
 
-	return t.Eval(expr)
+	return t.view().evalContext(context.Background(), expr)
 }
 
-func (t *Table) addRequiredSymbols(expr Expression, set symbolSet) {
-	for _, traversal := range expr.Variables() {
-		name := traversal.RootName()
-		if set.Has(name) {
-			continue
+// reference is where a symbol required by an evaluation is referred to: the
+// name of the symbol whose expression refers to it, which is empty for the
+// expression being evaluated, and the range of the reference.
+type reference struct {
+	from string
+	rng  hcl.Range
+}
+
+// requiredSymbols returns the symbols that the given expression requires,
+// directly or indirectly, along with the first of the shortest chains of
+// references that lead to each.
+func (t *Table) requiredSymbols(expr Expression) map[string]reference {
+	refs := make(map[string]reference)
+	queue := []string{""}
+	for len(queue) > 0 {
+		from := queue[0]
+		queue = queue[1:]
+		fromExpr := expr
+		if from != "" {
+			fromExpr = t.syms[from]
 		}
-		set.Add(traversal.RootName())
-		if reqdExpr, defined := t.syms[name]; defined {
-			t.addRequiredSymbols(reqdExpr, set)
+		for _, traversal := range fromExpr.Variables() {
+			name := traversal.RootName()
+			if _, found := refs[name]; found {
+				continue
+			}
+			refs[name] = reference{
+				from: from,
+				rng:  traversal.SourceRange(),
+			}
+			if _, defined := t.syms[name]; defined {
+				queue = append(queue, name)
+			}
 		}
 	}
+	return refs
+}
+
+// undefinedDiag returns a diagnostic for a reference to the undefined
+// symbol with the given name, found by requiredSymbols. If the evaluated
+// expression doesn't refer to the symbol directly then the diagnostic
+// describes the chain of symbols that leads to it.
+func (t *Table) undefinedDiag(name string, refs map[string]reference, extraVars map[string]cty.Value) *hcl.Diagnostic {
+	ref := refs[name]
+	suggestion := t.symbolSuggestions(name, extraVars)
+	diag := &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Variable not defined",
+		Detail:   fmt.Sprintf("The variable %q has not yet had an expression assigned.%s", name, suggestion),
+		Subject:  ref.rng.Ptr(),
+	}
+	if ref.from == "" {
+		return diag
+	}
+
+	chain := []string{name}
+	for from := ref.from; from != ""; from = refs[from].from {
+		chain = append(chain, from)
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	diag.Detail = fmt.Sprintf("The variable %q has not yet had an expression assigned. It is referred to by the expression for %q, and this expression requires it through %s.%s", name, ref.from, strings.Join(chain, " → "), suggestion)
+	return diag
 }
 
+// Values evaluates all of the symbols in the table, returning their values
+// in an order where each symbol comes after those it depends on.
 func (t *Table) Values() ([]TableSymbolValue, hcl.Diagnostics) {
+	return t.ValuesContext(context.Background())
+}
+
+// ValuesContext is like Values, but stops evaluating if the given context
+// is cancelled, in which case the symbols that were not yet evaluated
+// have unknown values.
+func (t *Table) ValuesContext(ctx context.Context) ([]TableSymbolValue, hcl.Diagnostics) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.view().valuesContext(ctx)
+}
+
+func (t *Table) valuesContext(ctx context.Context) ([]TableSymbolValue, hcl.Diagnostics) {
 	if len(t.all) == 0 {
 		return nil, nil
 	}
+	g, done := t.startGuard(ctx)
+	defer done()
 
 	ret := make([]TableSymbolValue, 0, len(t.all))
 	var diags hcl.Diagnostics
 
-	ctx := globalCtx.NewChild()
-	ctx.Variables = make(map[string]cty.Value, len(t.all))
-	ctx.Functions = t.funcs
+	evalCtx := t.builtins.NewChild()
+	evalCtx.Functions = t.funcs
 
-	cycled := t.visitSymbols(t.all, func(name string, expr Expression) {
-		val, valDiags := expr.Value(ctx)
+	order, results, cycled := t.evalSymbols(t.all, evalCtx, t.parallelism)
+	for i, name := range order {
 		ret = append(ret, TableSymbolValue{
 			Symbol: name,
-			Value:  val,
+			Value:  results[i].val,
 		})
-		ctx.Variables[name] = val
-		diags = append(diags, valDiags...)
-	})
+		diags = append(diags, results[i].diags...)
+	}
 
 	if len(cycled) > 0 {
 		firstCycled := len(ret)
@@ -241,21 +778,73 @@ func (t *Table) Values() ([]TableSymbolValue, hcl.Diagnostics) {
 		})
 	}
 
-	return ret, diags
+	return ret, append(diags, g.stoppedDiags()...)
 }
 
+// Eval evaluates the given expression using the symbols in the table.
 func (t *Table) Eval(expr Expression) (cty.Value, hcl.Diagnostics) {
-	return t.eval(expr, nil, nil)
+	return t.EvalContext(context.Background(), expr)
 }
 
-func (t *Table) eval(expr Expression, extraVars map[string]cty.Value, extraFuncs map[string]function.Function) (cty.Value, hcl.Diagnostics) {
-	var diags hcl.Diagnostics
+// EvalContext is like Eval, but stops evaluating if the given context is
+// cancelled, in which case the result is unknown.
+func (t *Table) EvalContext(ctx context.Context, expr Expression) (cty.Value, hcl.Diagnostics) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.view().evalContext(ctx, expr)
+}
 
-	reqd := newSymbolSet()
-	t.addRequiredSymbols(expr, reqd)
+func (t *Table) evalContext(ctx context.Context, expr Expression) (cty.Value, hcl.Diagnostics) {
+	g, done := t.startGuard(ctx)
+	defer done()
 
-	for name := range extraVars {
-		reqd.Remove(name)
+	val, diags := t.eval(expr, nil, nil, t.parallelism)
+	if stopped := g.stoppedDiags(); stopped != nil {
+		// Whatever else went wrong was most likely caused by stopping
+		// early, so we'll report only that.
+		return cty.DynamicVal, stopped
+	}
+	return val, diags
+}
+
+// symbolValue returns the value of the symbol with the given name and
+// expression, evaluating it in the given context if its value isn't cached.
+func (t *Table) symbolValue(name string, expr Expression, ctx *hcl.EvalContext) (cty.Value, hcl.Diagnostics) {
+	if _, defined := t.syms[name]; !defined {
+		return t.guardedValue(expr, ctx)
+	}
+	if cv, cached := t.cache.get(name); cached {
+		return cv.val, cv.diags
+	}
+	val, diags := t.guardedValue(expr, ctx)
+	if t.active.err() == nil && t.cacheable(expr) {
+		t.cache.put(name, val, diags)
+	}
+	return val, diags
+}
+
+// guardedValue evaluates the given expression in the given context,
+// checking its result against the limits of the current evaluation.
+func (t *Table) guardedValue(expr Expression, ctx *hcl.EvalContext) (cty.Value, hcl.Diagnostics) {
+	val, diags := expr.Value(ctx)
+	suggestFuncs(diags, expr, ctx)
+	if limitDiags := t.active.resultDiags(val, expr); limitDiags != nil {
+		return cty.DynamicVal, append(diags, limitDiags...)
+	}
+	return val, diags
+}
+
+// eval evaluates the given expression along with the symbols it requires,
+// using up to the given number of goroutines to evaluate the symbols.
+func (t *Table) eval(expr Expression, extraVars map[string]cty.Value, extraFuncs map[string]function.Function, workers int) (cty.Value, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+
+	refs := t.requiredSymbols(expr)
+	reqd := make(symbolSet, len(refs))
+	for name := range refs {
+		if _, isParam := extraVars[name]; !isParam {
+			reqd.Add(name)
+		}
 	}
 
 	var undef []string
@@ -267,22 +856,18 @@ func (t *Table) eval(expr Expression, extraVars map[string]cty.Value, extraFuncs
 	}
 	sort.Strings(undef)
 	for _, name := range undef {
-		diags = append(diags, &hcl.Diagnostic{
-			Severity: hcl.DiagError,
-			Summary:  "Variable not defined",
-			Detail:   fmt.Sprintf("The variable %q has not yet had an expression assigned.", name),
-		})
+		diags = append(diags, t.undefinedDiag(name, refs, extraVars))
 	}
 
-	ctx := globalCtx.NewChild()
-	ctx.Variables = make(map[string]cty.Value, len(reqd))
+	ctx := t.builtins.NewChild()
 	ctx.Functions = t.funcs
 
-	cycled := t.visitSymbols(reqd, func(name string, expr Expression) {
-		val, valDiags := expr.Value(ctx)
-		diags = append(diags, valDiags...)
-		ctx.Variables[name] = val
-	})
+	order, results, cycled := t.evalSymbols(reqd, ctx, workers)
+	ctx.Variables = make(map[string]cty.Value, len(reqd))
+	for i, name := range order {
+		ctx.Variables[name] = results[i].val
+		diags = append(diags, results[i].diags...)
+	}
 
 	if len(cycled) > 0 {
 		for name := range cycled {
@@ -299,22 +884,18 @@ func (t *Table) eval(expr Expression, extraVars map[string]cty.Value, extraFuncs
 	if extraVars != nil || extraFuncs != nil {
 		ctx = ctx.NewChild()
 		ctx.Variables = extraVars
-		ctx.Functions = extraFuncs
+		ctx.Functions = t.deferredFuncs(ctx, extraFuncs)
 	}
 
-	ret, valDiags := expr.Value(ctx)
+	ret, valDiags := t.guardedValue(expr, ctx)
 	diags = append(diags, valDiags...)
 	return ret, diags
 }
 
+// NamesWithPrefix returns the names of the defined symbols that start with
+// the given prefix, in lexicographical order.
 func (t *Table) NamesWithPrefix(prefix string) []string {
-	var ret []string
-	for name := range t.syms {
-		if strings.HasPrefix(name, prefix) {
-			ret = append(ret, name)
-		}
-	}
-	return ret
+	return t.names.WithPrefix(prefix)
 }
 
 var missingExpr = Expression{
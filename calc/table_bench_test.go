@@ -0,0 +1,93 @@
+package calc
+
+import (
+	"fmt"
+	"testing"
+)
+
+// benchSymbols is the number of symbols in the tables used by the
+// benchmarks.
+const benchSymbols = 100000
+
+// benchExprs returns expressions for benchSymbols symbols named s0, s1 and
+// so on, each but the first referring to the one before it.
+func benchExprs(b *testing.B) []Expression {
+	exprs := make([]Expression, benchSymbols)
+	exprs[0] = mustParse(b, "1")
+	for i := 1; i < len(exprs); i++ {
+		exprs[i] = mustParse(b, fmt.Sprintf("s%d + 1", i-1))
+	}
+	return exprs
+}
+
+// benchTable returns a table with the symbols from benchExprs defined.
+func benchTable(b *testing.B) *Table {
+	table := NewTable()
+	batch := table.Batch()
+	for i, expr := range benchExprs(b) {
+		batch.Define(fmt.Sprintf("s%d", i), expr)
+	}
+	if diags := batch.Commit(); diags.HasErrors() {
+		b.Fatal(diags.Error())
+	}
+	return table
+}
+
+func BenchmarkDefine100k(b *testing.B) {
+	exprs := benchExprs(b)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		table := NewTable()
+		for i, expr := range exprs {
+			if diags := table.Define(fmt.Sprintf("s%d", i), expr); diags.HasErrors() {
+				b.Fatal(diags.Error())
+			}
+		}
+	}
+}
+
+func BenchmarkBatch100k(b *testing.B) {
+	exprs := benchExprs(b)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		table := NewTable()
+		batch := table.Batch()
+		for i, expr := range exprs {
+			batch.Define(fmt.Sprintf("s%d", i), expr)
+		}
+		if diags := batch.Commit(); diags.HasErrors() {
+			b.Fatal(diags.Error())
+		}
+	}
+}
+
+func BenchmarkRedefine(b *testing.B) {
+	table := benchTable(b)
+	exprs := []Expression{mustParse(b, "s50000 + 2"), mustParse(b, "s50000 + 1")}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if diags := table.Define("s50001", exprs[n%2]); diags.HasErrors() {
+			b.Fatal(diags.Error())
+		}
+	}
+}
+
+func BenchmarkNamesWithPrefix(b *testing.B) {
+	table := benchTable(b)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if got := len(table.NamesWithPrefix("s9999")); got != 11 {
+			b.Fatalf("got %d names, want 11", got)
+		}
+	}
+}
+
+func BenchmarkValues(b *testing.B) {
+	table := benchTable(b)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, diags := table.Values(); diags.HasErrors() {
+			b.Fatal(diags.Error())
+		}
+	}
+}
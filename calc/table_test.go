@@ -0,0 +1,85 @@
+package calc
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestTableConcurrentUse uses a table from several goroutines at once, to
+// find data races when run with "go test -race".
+func TestTableConcurrentUse(t *testing.T) {
+	const workers = 4
+	const rounds = 50
+
+	table := NewTable()
+	if diags := table.Define("base", mustParse(t, "1")); diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+
+	// The expressions are parsed up front, since a test can't fail from
+	// another goroutine.
+	sums := make([]Expression, rounds)
+	products := make([]Expression, rounds)
+	for i := range sums {
+		sums[i] = mustParse(t, fmt.Sprintf("base + %d", i))
+		products[i] = mustParse(t, fmt.Sprintf("base * %d", i))
+	}
+	nexts := make([]Expression, workers)
+	for w := range nexts {
+		nexts[w] = mustParse(t, fmt.Sprintf("b%d_1 + 1", w))
+	}
+
+	var wg sync.WaitGroup
+	run := func(f func(w, i int)) {
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < rounds; i++ {
+					f(w, i)
+				}
+			}(w)
+		}
+	}
+
+	run(func(w, i int) {
+		name := fmt.Sprintf("d%d_%d", w, i%5)
+		table.Define(name, sums[i])
+	})
+	run(func(w, i int) {
+		batch := table.Batch()
+		batch.Define(fmt.Sprintf("b%d_1", w), products[i])
+		batch.Define(fmt.Sprintf("b%d_2", w), nexts[w])
+		batch.Commit()
+	})
+	run(func(w, i int) {
+		if _, diags := table.Eval(sums[i]); diags.HasErrors() {
+			t.Error(diags.Error())
+		}
+	})
+	run(func(w, i int) {
+		if _, diags := table.Values(); diags.HasErrors() {
+			t.Error(diags.Error())
+		}
+	})
+	run(func(w, i int) {
+		table.NamesWithPrefix("d")
+	})
+	run(func(w, i int) {
+		snap := table.Snapshot()
+		if _, diags := snap.Values(); diags.HasErrors() {
+			t.Error(diags.Error())
+		}
+	})
+	wg.Wait()
+
+	for w := 0; w < workers; w++ {
+		for i := 0; i < 5; i++ {
+			name := fmt.Sprintf("d%d_%d", w, i)
+			if table.Source(name) == nil {
+				t.Errorf("%s is not defined", name)
+			}
+		}
+	}
+}
@@ -6,6 +6,14 @@ func newEdgeSet() edgeSet {
 	return map[string]symbolSet{}
 }
 
+func (s edgeSet) Copy() edgeSet {
+	ret := make(edgeSet, len(s))
+	for from, tos := range s {
+		ret[from] = tos.Copy()
+	}
+	return ret
+}
+
 func (s edgeSet) Add(from, to string) {
 	if _, exists := s[from]; !exists {
 		s[from] = newSymbolSet()
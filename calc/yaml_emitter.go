@@ -0,0 +1,353 @@
+package calc
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Terraform's yamlencode uses a copy of the YAML library's emitter, a port
+// of libyaml, that chooses a different style for strings. The YAML library
+// doesn't let its callers choose the style of a scalar, so quotedYAML
+// instead reproduces the parts of that emitter that the values of
+// expressions can reach: block mappings and sequences, empty flow
+// collections, plain scalars for everything but strings, and double-quoted
+// or literal strings. The emitter's fields and methods follow the libyaml
+// functions of similar names, so that the rules for indentation, line
+// folding and escaping stay recognizably the same.
+
+const (
+	yamlBestIndent   = 2
+	yamlBestWidth    = 80
+	yamlMaxSimpleKey = 128
+)
+
+// quotedYAML returns the YAML encoding of the given wholly-known value, as
+// Terraform's yamlencode writes it.
+func quotedYAML(val cty.Value) string {
+	e := &yamlEmitter{
+		indent:     -1,
+		whitespace: true,
+		indention:  true,
+	}
+	e.node(val, false, false)
+
+	// The end of the document.
+	e.indent = -1
+	e.writeIndent()
+	return e.buf.String()
+}
+
+type yamlEmitter struct {
+	buf    bytes.Buffer
+	column int
+	indent int
+
+	// whitespace records whether the last character written was
+	// whitespace, and indention whether the current line so far is only
+	// indentation and indicators.
+	whitespace bool
+	indention  bool
+}
+
+func (e *yamlEmitter) put(s string) {
+	e.buf.WriteString(s)
+	e.column += utf8.RuneCountInString(s)
+}
+
+func (e *yamlEmitter) putBreak() {
+	e.buf.WriteByte('\n')
+	e.column = 0
+}
+
+func (e *yamlEmitter) writeIndent() {
+	indent := e.indent
+	if indent < 0 {
+		indent = 0
+	}
+	if !e.indention || e.column > indent || (e.column == indent && !e.whitespace) {
+		e.putBreak()
+	}
+	for e.column < indent {
+		e.put(" ")
+	}
+	e.whitespace = true
+	e.indention = true
+}
+
+func (e *yamlEmitter) writeIndicator(indicator string, needWhitespace, isWhitespace, isIndention bool) {
+	if needWhitespace && !e.whitespace {
+		e.put(" ")
+	}
+	e.put(indicator)
+	e.whitespace = isWhitespace
+	e.indention = e.indention && isIndention
+}
+
+// increaseIndent indents the lines that follow, returning the indentation
+// to restore afterwards.
+func (e *yamlEmitter) increaseIndent(flow, indentless bool) int {
+	prev := e.indent
+	switch {
+	case e.indent < 0 && flow:
+		e.indent = yamlBestIndent
+	case e.indent < 0:
+		e.indent = 0
+	case !indentless:
+		e.indent += yamlBestIndent
+	}
+	return prev
+}
+
+// node writes the given value. mapping is set for the keys and values of
+// mappings, and simpleKey for keys written without the "?" indicator.
+func (e *yamlEmitter) node(val cty.Value, mapping, simpleKey bool) {
+	ty := val.Type()
+	switch {
+	case val.IsNull():
+		e.plain("null")
+	case ty == cty.String:
+		e.str(val.AsString(), simpleKey)
+	case ty == cty.Bool:
+		if val.True() {
+			e.plain("true")
+		} else {
+			e.plain("false")
+		}
+	case ty == cty.Number:
+		e.plain(val.AsBigFloat().Text('f', -1))
+	case ty.IsObjectType() || ty.IsMapType():
+		attrs := valueAttrs(val)
+		if len(attrs) == 0 {
+			e.writeIndicator("{", true, true, false)
+			e.writeIndicator("}", false, false, false)
+			return
+		}
+		keys := make([]string, 0, len(attrs))
+		for k := range attrs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		prev := e.increaseIndent(false, false)
+		for _, k := range keys {
+			e.writeIndent()
+			if len(k) <= yamlMaxSimpleKey && !yamlMultiline(k) {
+				e.str(k, true)
+				e.writeIndicator(":", false, false, false)
+			} else {
+				e.writeIndicator("?", true, false, true)
+				e.str(k, false)
+				e.writeIndent()
+				e.writeIndicator(":", true, false, true)
+			}
+			e.node(attrs[k], true, false)
+		}
+		e.indent = prev
+	case ty.IsListType() || ty.IsSetType() || ty.IsTupleType():
+		if val.LengthInt() == 0 {
+			e.writeIndicator("[", true, true, false)
+			e.writeIndicator("]", false, false, false)
+			return
+		}
+
+		// A sequence that is the value of a mapping entry isn't indented
+		// any further than the entry's key.
+		prev := e.increaseIndent(false, mapping && !e.indention)
+		for it := val.ElementIterator(); it.Next(); {
+			_, ev := it.Element()
+			e.writeIndent()
+			e.writeIndicator("-", true, false, true)
+			e.node(ev, false, false)
+		}
+		e.indent = prev
+	default:
+		// Should never happen, since the above covers all of the types
+		// that can be produced by expressions.
+		e.str(fmt.Sprintf("%#v", val), simpleKey)
+	}
+}
+
+func (e *yamlEmitter) plain(s string) {
+	if !e.whitespace {
+		e.put(" ")
+	}
+	e.put(s)
+	e.whitespace = false
+	e.indention = false
+}
+
+// str writes a string as a literal block if it has line breaks and YAML
+// allows it to be one, and double-quoted otherwise.
+func (e *yamlEmitter) str(s string, simpleKey bool) {
+	prev := e.increaseIndent(true, false)
+	if strings.Contains(s, "\n") && !simpleKey && yamlBlockAllowed(s) {
+		e.literal(s)
+	} else {
+		e.doubleQuoted(s, !simpleKey)
+	}
+	e.indent = prev
+}
+
+func (e *yamlEmitter) doubleQuoted(s string, allowBreaks bool) {
+	e.writeIndicator(`"`, true, false, false)
+
+	// libyaml escapes every character of a string that starts with a
+	// byte order mark.
+	bom := strings.HasPrefix(s, "\ufeff")
+	spaces := false
+	for i, r := range s {
+		switch {
+		case bom || !yamlPrintable(r) || yamlBreak(r) || r == '"' || r == '\\':
+			e.put(yamlEscape(r))
+			spaces = false
+		case r == ' ':
+			// Long strings are folded at a space, which a reader turns
+			// back into a space. An escaped line break keeps a second
+			// space from being folded away too.
+			if allowBreaks && !spaces && e.column > yamlBestWidth && i > 0 && i < len(s)-1 {
+				e.writeIndent()
+				if s[i+1] == ' ' {
+					e.put(`\`)
+				}
+			} else {
+				e.put(" ")
+			}
+			spaces = true
+		default:
+			e.put(string(r))
+			spaces = false
+		}
+	}
+	e.writeIndicator(`"`, false, false, false)
+	e.whitespace = false
+	e.indention = false
+}
+
+func (e *yamlEmitter) literal(s string) {
+	e.writeIndicator("|", true, false, false)
+
+	// A block whose content starts with whitespace needs its indentation
+	// given explicitly, and the chomping indicator says how many of the
+	// line breaks at the end belong to the string.
+	first, _ := utf8.DecodeRuneInString(s)
+	if first == ' ' || yamlBreak(first) {
+		e.writeIndicator(fmt.Sprint(yamlBestIndent), false, false, false)
+	}
+	last, size := utf8.DecodeLastRuneInString(s)
+	beforeLast, _ := utf8.DecodeLastRuneInString(s[:len(s)-size])
+	switch {
+	case !yamlBreak(last):
+		e.writeIndicator("-", false, false, false)
+	case size == len(s) || yamlBreak(beforeLast):
+		e.writeIndicator("+", false, false, false)
+	}
+
+	e.putBreak()
+	e.indention = true
+	e.whitespace = true
+	breaks := true
+	for _, r := range s {
+		if yamlBreak(r) {
+			if r == '\n' {
+				e.putBreak()
+			} else {
+				e.buf.WriteRune(r)
+				e.column = 0
+			}
+			e.indention = true
+			breaks = true
+			continue
+		}
+		if breaks {
+			e.writeIndent()
+		}
+		e.put(string(r))
+		e.indention = false
+		breaks = false
+	}
+}
+
+// yamlPrintable returns true if YAML allows the given character to appear
+// in a string without escaping it.
+func yamlPrintable(r rune) bool {
+	switch {
+	case r == '\n':
+		return true
+	case r >= 0x20 && r <= 0x7E:
+		return true
+	case r >= 0xA0 && r <= 0xD7FF:
+		return true
+	case r >= 0xE000 && r <= 0xFFFD:
+		return r != 0xFEFF
+	default:
+		// libyaml also escapes everything outside of the Basic
+		// Multilingual Plane.
+		return false
+	}
+}
+
+func yamlBreak(r rune) bool {
+	switch r {
+	case '\r', '\n', 0x85, 0x2028, 0x2029:
+		return true
+	default:
+		return false
+	}
+}
+
+func yamlMultiline(s string) bool {
+	return strings.IndexFunc(s, yamlBreak) >= 0
+}
+
+// yamlBlockAllowed returns true if the given string can be written as a
+// literal block.
+func yamlBlockAllowed(s string) bool {
+	if s == "" || strings.HasSuffix(s, " ") {
+		return false
+	}
+	prevSpace := false
+	for _, r := range s {
+		if !yamlPrintable(r) || (prevSpace && yamlBreak(r)) {
+			return false
+		}
+		prevSpace = r == ' '
+	}
+	return true
+}
+
+var yamlEscapes = map[rune]string{
+	0x00:   `\0`,
+	0x07:   `\a`,
+	0x08:   `\b`,
+	0x09:   `\t`,
+	0x0A:   `\n`,
+	0x0B:   `\v`,
+	0x0C:   `\f`,
+	0x0D:   `\r`,
+	0x1B:   `\e`,
+	'"':    `\"`,
+	'\\':   `\\`,
+	0x85:   `\N`,
+	0xA0:   `\_`,
+	0x2028: `\L`,
+	0x2029: `\P`,
+}
+
+func yamlEscape(r rune) string {
+	if esc, ok := yamlEscapes[r]; ok {
+		return esc
+	}
+	switch {
+	case r <= 0xFF:
+		return fmt.Sprintf(`\x%02X`, r)
+	case r <= 0xFFFF:
+		return fmt.Sprintf(`\u%04X`, r)
+	default:
+		return fmt.Sprintf(`\U%08X`, r)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apparentlymart/hclcalc/calc"
+	"github.com/apparentlymart/hclcalc/plugin"
+	"github.com/hashicorp/hcl2/gohcl"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/hashicorp/hcl2/hclparse"
+)
+
+// config is the content of the configuration file, which declares the
+// plugins to launch at startup:
+//
+//	plugin "lookup" {
+//	  command = "/usr/local/bin/hclcalc-lookup"
+//	  args    = ["-data", "/etc/lookup.json"]
+//	  impure  = true
+//	  timeout = "5s"
+//	}
+//
+// A plugin is impure if its functions may return different results for the
+// same arguments, such as if they read files that might change. The timeout
+// is how long to wait for the plugin to respond to each request, which is
+// plugin.DefaultTimeout if not set, or no limit if "0s".
+type config struct {
+	Plugins []*pluginConfig `hcl:"plugin,block"`
+}
+
+type pluginConfig struct {
+	Name    string   `hcl:"name,label"`
+	Command string   `hcl:"command"`
+	Args    []string `hcl:"args,optional"`
+	Impure  bool     `hcl:"impure,optional"`
+	Timeout string   `hcl:"timeout,optional"`
+}
+
+// defaultConfigFile returns the path of the configuration file that is used
+// if none is given, which may not exist.
+func defaultConfigFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".hclcalc.hcl")
+}
+
+func loadConfig(filename string) (*config, hcl.Diagnostics) {
+	parser := hclparse.NewParser()
+	f, diags := parser.ParseHCLFile(filename)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	var cfg config
+	diags = append(diags, gohcl.DecodeBody(f.Body, nil, &cfg)...)
+	return &cfg, diags
+}
+
+// launchPlugins starts each of the plugins declared in the given config and
+// returns the running plugins along with options that register their
+// functions with a table. A plugin function replaces any builtin function
+// of the same name, and a later plugin's function replaces an earlier
+// one's, with a warning in each case.
+func launchPlugins(cfg *config) ([]*plugin.Client, []calc.Option, hcl.Diagnostics) {
+	var clients []*plugin.Client
+	var opts []calc.Option
+	var diags hcl.Diagnostics
+	providers := make(map[string]string) // function name to plugin name
+	for _, pc := range cfg.Plugins {
+		timeout := plugin.DefaultTimeout
+		if pc.Timeout != "" {
+			var err error
+			timeout, err = time.ParseDuration(pc.Timeout)
+			if err != nil || timeout < 0 {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid plugin timeout",
+					Detail:   fmt.Sprintf("The timeout for plugin %q must be a duration such as \"5s\".", pc.Name),
+				})
+				continue
+			}
+		}
+
+		client, err := plugin.Launch(pc.Name, pc.Command, pc.Args...)
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Failed to launch plugin",
+				Detail:   err.Error(),
+			})
+			continue
+		}
+		clients = append(clients, client)
+		client.SetTimeout(timeout)
+
+		funcs, err := client.Functions()
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Failed to load plugin functions",
+				Detail:   err.Error(),
+			})
+			continue
+		}
+		names := make([]string, 0, len(funcs))
+		for name := range funcs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			f := funcs[name]
+			if !hclsyntax.ValidIdentifier(name) {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagWarning,
+					Summary:  "Invalid plugin function name",
+					Detail:   fmt.Sprintf("Plugin %q provides a function named %q, which is not a valid function name, so it will be ignored.", pc.Name, name),
+				})
+				continue
+			}
+			if calc.ReservedFunc(name) {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagWarning,
+					Summary:  "Reserved plugin function name",
+					Detail:   fmt.Sprintf("Plugin %q provides a function named %q, which is reserved for a builtin function, so it will be ignored.", pc.Name, name),
+				})
+				continue
+			}
+			if other, exists := providers[name]; exists {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagWarning,
+					Summary:  "Duplicate plugin function",
+					Detail:   fmt.Sprintf("Plugins %q and %q both provide a function named %q, so the one from plugin %q will be used.", other, pc.Name, name, pc.Name),
+				})
+			} else if builtin := calc.ProfilesWithFunc(name); len(builtin) != 0 {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagWarning,
+					Summary:  "Plugin function replaces a builtin function",
+					Detail:   fmt.Sprintf("Plugin %q provides a function named %q, which will be used instead of the builtin function of the same name in these profiles: %s.", pc.Name, name, strings.Join(builtin, ", ")),
+				})
+			}
+			providers[name] = pc.Name
+
+			if pc.Impure {
+				opts = append(opts, calc.WithImpureFunction(name, f))
+			} else {
+				opts = append(opts, calc.WithFunction(name, f))
+			}
+		}
+	}
+	return clients, opts, diags
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apparentlymart/hclcalc/calc"
+	"github.com/apparentlymart/hclcalc/plugin"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// fakePluginEnv is the environment variable that makes the test binary act
+// as a plugin, rather than running the tests, serving the set of functions
+// named by its first argument.
+const fakePluginEnv = "HCLCALC_FAKE_PLUGIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fakePluginEnv) != "" {
+		if err := plugin.Serve(fakePluginFuncs[os.Args[1]]); err != nil {
+			fmt.Fprintf(os.Stderr, "fake plugin: %s\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakePluginFuncs are the sets of functions that the fake plugin can serve.
+var fakePluginFuncs = map[string]map[string]function.Function{
+	"first": {
+		"double":    constFunc(cty.StringVal("first")),
+		"lookup":    constFunc(cty.StringVal("first")),
+		"uuid":      constFunc(cty.StringVal("first")),
+		"not valid": constFunc(cty.StringVal("first")),
+	},
+	"second": {
+		"double": constFunc(cty.StringVal("second")),
+	},
+}
+
+func constFunc(v cty.Value) function.Function {
+	return function.New(&function.Spec{
+		Type: function.StaticReturnType(v.Type()),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return v, nil
+		},
+	})
+}
+
+// launchTestConfig writes the given configuration to a file, loads it and
+// launches its plugins, with the test binary available as $PLUGIN.
+func launchTestConfig(t *testing.T, src string) ([]calc.Option, hcl.Diagnostics) {
+	t.Setenv(fakePluginEnv, "1")
+	src = strings.Replace(src, "$PLUGIN", fmt.Sprintf("%q", os.Args[0]), -1)
+	filename := filepath.Join(t.TempDir(), "config.hcl")
+	if err := os.WriteFile(filename, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, diags := loadConfig(filename)
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	clients, opts, diags := launchPlugins(cfg)
+	t.Cleanup(func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	})
+	return opts, diags
+}
+
+func evalString(t *testing.T, table *calc.Table, src string) string {
+	expr, diags := calc.ParseExpressionString(src, "test")
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	v, diags := table.Eval(expr)
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	return v.AsString()
+}
+
+func TestLaunchPlugins(t *testing.T) {
+	opts, diags := launchTestConfig(t, `
+plugin "first" {
+  command = $PLUGIN
+  args    = ["first"]
+}
+plugin "second" {
+  command = $PLUGIN
+  args    = ["second"]
+  timeout = "5s"
+}
+`)
+
+	var got []string
+	for _, diag := range diags {
+		if diag.Severity != hcl.DiagWarning {
+			t.Errorf("unexpected error: %s: %s", diag.Summary, diag.Detail)
+			continue
+		}
+		got = append(got, diag.Summary+": "+diag.Detail)
+	}
+	want := []string{
+		`Plugin function replaces a builtin function: Plugin "first" provides a function named "lookup", which will be used instead of the builtin function of the same name in these profiles: all, terraform.`,
+		`Invalid plugin function name: Plugin "first" provides a function named "not valid", which is not a valid function name, so it will be ignored.`,
+		`Reserved plugin function name: Plugin "first" provides a function named "uuid", which is reserved for a builtin function, so it will be ignored.`,
+		`Duplicate plugin function: Plugins "first" and "second" both provide a function named "double", so the one from plugin "second" will be used.`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("wrong warnings\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	table := calc.NewTable(opts...)
+	if err := table.SetProfile("terraform"); err != nil {
+		t.Fatal(err)
+	}
+	if got := evalString(t, table, "double()"); got != "second" {
+		t.Errorf("double() is %q, want \"second\"", got)
+	}
+	if got := evalString(t, table, "lookup()"); got != "first" {
+		t.Errorf("lookup() is %q, want \"first\"", got)
+	}
+}
+
+func TestLaunchPluginsInvalidTimeout(t *testing.T) {
+	opts, diags := launchTestConfig(t, `
+plugin "first" {
+  command = $PLUGIN
+  args    = ["first"]
+  timeout = "soon"
+}
+`)
+	if len(opts) != 0 {
+		t.Errorf("got %d options, want none", len(opts))
+	}
+	if len(diags) != 1 || diags[0].Summary != "Invalid plugin timeout" {
+		t.Errorf("wrong diagnostics: %s", diags.Error())
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+)
+
+// loadFile loads the definitions in the file at the given path, returning
+// true if they were all defined.
+func (u ui) loadFile(path string) bool {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		var diags hcl.Diagnostics
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to read file",
+			Detail:   fmt.Sprintf("Cannot read definitions from %s: %s.", path, err),
+		})
+		u.showDiags(diags)
+		return false
+	}
+	return u.load(src, path)
+}
+
+// paste reads definitions from the terminal until the user enters an empty
+// line and then loads them, returning true if they were all defined.
+func (u ui) paste() bool {
+	fmt.Print("Enter definitions, followed by an empty line.\n")
+	var src []byte
+	for {
+		line, err := readLine()
+		if err != nil || len(bytes.TrimSpace(line)) == 0 {
+			break
+		}
+		src = append(src, line...)
+		src = append(src, '\n')
+	}
+	return u.load(src, "the pasted text")
+}
+
+// readLine reads a single line from the standard input. It reads one byte
+// at a time so that nothing after the line is consumed, since the prompt
+// reads from the standard input too.
+func readLine() ([]byte, error) {
+	var line []byte
+	var buf [1]byte
+	for {
+		n, err := os.Stdin.Read(buf[:])
+		if n == 1 {
+			if buf[0] == '\n' {
+				return line, nil
+			}
+			line = append(line, buf[0])
+		}
+		if err != nil {
+			return line, err
+		}
+	}
+}
+
+// load defines all of the symbols and functions in the given source code,
+// or none of them if any are invalid, returning true if they were defined.
+// Each line is a definition like those entered at the prompt, except that
+// blank lines and lines starting with # are ignored. The description is
+// used to refer to the source code in messages to the user.
+func (u ui) load(src []byte, desc string) bool {
+	batch := u.table.Batch()
+	valid := true
+	for i, line := range bytes.Split(src, []byte{'\n'}) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		toks, _ := hclsyntax.LexExpression(line, "", hcl.Pos{Line: 1, Column: 1})
+		lvalueSrc, exprSrc, ok := splitAssignment(toks[:len(toks)-1], line)
+		if !ok {
+			var diags hcl.Diagnostics
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid definition",
+				Detail:   fmt.Sprintf("Line %d of %s is not a definition. Each line must assign an expression to a name or define a function.", i+1, desc),
+			})
+			u.showDiags(diags)
+			valid = false
+			continue
+		}
+		if !u.assign(batch, lvalueSrc, exprSrc) {
+			valid = false
+		}
+	}
+
+	if valid {
+		diags := batch.Commit()
+		u.showDiagsFrom(diags, nil, batch.Source)
+		valid = !diags.HasErrors()
+	}
+	if !valid {
+		fmt.Printf("No changes were made, because of the errors in %s.\n\n", desc)
+		return false
+	}
+	fmt.Printf("Loaded %d definitions from %s.\n\n", batch.Len(), desc)
+	return true
+}
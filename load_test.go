@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/apparentlymart/hclcalc/calc"
+	prompt "github.com/c-bata/go-prompt"
+)
+
+func testUI() ui {
+	return ui{
+		table:    calc.NewTable(),
+		size:     &prompt.WinSize{Row: 40, Col: 80},
+		settings: &settings{},
+	}
+}
+
+func TestLoad(t *testing.T) {
+	u := testUI()
+	src := []byte("# A comment\na = 1\n\nb = a + 1\ndouble(x) = x * 2\n")
+	if !u.load(src, "the test") {
+		t.Fatal("load failed")
+	}
+	for name, want := range map[string]string{"a": "1", "b": "a + 1"} {
+		if got := string(bytes.TrimSpace(u.table.Source(name))); got != want {
+			t.Errorf("%s is %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestLoadParseError(t *testing.T) {
+	u := testUI()
+	if !u.load([]byte("a = 1\n"), "the test") {
+		t.Fatal("load failed")
+	}
+
+	// The parse error on the last line means that none of the lines are
+	// loaded, including the valid ones before it.
+	if u.load([]byte("a = 2\nb = a + 1\nc = (\n"), "the test") {
+		t.Fatal("load succeeded")
+	}
+	if got := string(bytes.TrimSpace(u.table.Source("a"))); got != "1" {
+		t.Errorf("a is %q, want \"1\"", got)
+	}
+	if got := u.table.Source("b"); got != nil {
+		t.Errorf("b is %q, want it to be undefined", got)
+	}
+}
+
+func TestLoadFuncErrors(t *testing.T) {
+	tests := map[string]string{
+		"parse error":         "a = 2\nf(x) = x + (\n",
+		"undefined reference": "a = 2\nf(x) = x + nope\n",
+	}
+	for desc, src := range tests {
+		u := testUI()
+		if !u.load([]byte("a = 1\n"), "the test") {
+			t.Fatal("load failed")
+		}
+		if u.load([]byte(src), "the test") {
+			t.Errorf("%s: load succeeded", desc)
+			continue
+		}
+		if got := string(bytes.TrimSpace(u.table.Source("a"))); got != "1" {
+			t.Errorf("%s: a is %q, want \"1\"", desc, got)
+		}
+	}
+}
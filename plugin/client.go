@@ -0,0 +1,241 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// DefaultTimeout is how long a client waits for a plugin to respond to a
+// request, unless changed with SetTimeout.
+const DefaultTimeout = 30 * time.Second
+
+// Client is a running plugin process.
+type Client struct {
+	name string
+	cmd  *exec.Cmd
+
+	// mu serializes requests, since the protocol allows only one
+	// outstanding request at a time.
+	mu      sync.Mutex
+	stdin   io.WriteCloser
+	stdout  *bufio.Reader
+	nextID  int
+	timeout time.Duration
+
+	// failed is set once the plugin has failed to respond in time, after
+	// which it is stopped and every request fails with this error, since
+	// a late response would be mistaken for the response to a later
+	// request.
+	failed error
+}
+
+// Launch starts the given plugin executable with the given arguments. The
+// name identifies the plugin in error messages.
+func Launch(name, command string, args ...string) (*Client, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start plugin %q: %s", name, err)
+	}
+	return &Client{
+		name:    name,
+		cmd:     cmd,
+		stdin:   stdin,
+		stdout:  bufio.NewReader(stdout),
+		timeout: DefaultTimeout,
+	}, nil
+}
+
+// SetTimeout changes how long the client waits for the plugin to respond
+// to each request, or removes the limit if zero. A plugin that doesn't
+// respond in time is stopped.
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timeout = timeout
+}
+
+// Name returns the name the plugin was launched with.
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Functions asks the plugin for the functions it provides and returns
+// a proxy function for each of them, which forwards its calls to the
+// plugin.
+func (c *Client) Functions() (map[string]function.Function, error) {
+	resp, err := c.request(&request{Method: "functions"})
+	if err != nil {
+		return nil, err
+	}
+
+	funcs := make(map[string]function.Function, len(resp.Functions))
+	for name, spec := range resp.Functions {
+		f, err := c.proxyFunc(name, spec)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %q has invalid function %q: %s", c.name, name, err)
+		}
+		funcs[name] = f
+	}
+	return funcs, nil
+}
+
+// Close stops the plugin by closing its stdin and then waits for it to
+// exit.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stdin.Close()
+	return c.cmd.Wait()
+}
+
+func (c *Client) proxyFunc(name string, spec *funcSpec) (function.Function, error) {
+	fs := &function.Spec{}
+	for _, ps := range spec.Params {
+		param, err := decodeParam(ps)
+		if err != nil {
+			return function.Function{}, err
+		}
+		fs.Params = append(fs.Params, param)
+	}
+	if spec.VarParam != nil {
+		param, err := decodeParam(spec.VarParam)
+		if err != nil {
+			return function.Function{}, err
+		}
+		fs.VarParam = &param
+	}
+
+	// We can't know what type a plugin function will return without
+	// calling it, so the result type is only checked once it's called.
+	fs.Type = function.StaticReturnType(cty.DynamicPseudoType)
+	fs.Impl = func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		req := &request{
+			Method:   "call",
+			Function: name,
+			Args:     make([]json.RawMessage, len(args)),
+		}
+		for i, arg := range args {
+			if !arg.IsWhollyKnown() {
+				return cty.DynamicVal, nil
+			}
+			buf, err := ctyjson.Marshal(arg, cty.DynamicPseudoType)
+			if err != nil {
+				return cty.DynamicVal, function.NewArgError(i, err)
+			}
+			req.Args[i] = buf
+		}
+
+		resp, err := c.request(req)
+		if err != nil {
+			return cty.DynamicVal, err
+		}
+		if resp.Error != nil {
+			if resp.Error.Arg != nil && *resp.Error.Arg >= 0 && *resp.Error.Arg < len(args) {
+				return cty.DynamicVal, function.NewArgError(*resp.Error.Arg, resp.Error)
+			}
+			return cty.DynamicVal, resp.Error
+		}
+		result, err := ctyjson.Unmarshal(resp.Result, cty.DynamicPseudoType)
+		if err != nil {
+			return cty.DynamicVal, fmt.Errorf("plugin %q returned an invalid result: %s", c.name, err)
+		}
+		return result, nil
+	}
+	return function.New(fs), nil
+}
+
+func decodeParam(ps *paramSpec) (function.Parameter, error) {
+	ty, err := ctyjson.UnmarshalType(ps.Type)
+	if err != nil {
+		return function.Parameter{}, fmt.Errorf("parameter %q has invalid type: %s", ps.Name, err)
+	}
+	return function.Parameter{
+		Name:      ps.Name,
+		Type:      ty,
+		AllowNull: ps.AllowNull,
+	}, nil
+}
+
+func (c *Client) request(req *request) (*response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failed != nil {
+		return nil, c.failed
+	}
+
+	c.nextID++
+	req.ID = c.nextID
+	buf, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	buf = append(buf, '\n')
+	if _, err := c.stdin.Write(buf); err != nil {
+		return nil, fmt.Errorf("failed to send request to plugin %q: %s", c.name, err)
+	}
+
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	var resp response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return nil, fmt.Errorf("plugin %q sent an invalid response: %s", c.name, err)
+	}
+	if resp.ID != req.ID {
+		return nil, fmt.Errorf("plugin %q sent a response to request %d when %d was expected", c.name, resp.ID, req.ID)
+	}
+	return &resp, nil
+}
+
+// readLine reads the next line from the plugin's stdout, stopping the
+// plugin if it doesn't arrive within the client's timeout.
+func (c *Client) readLine() ([]byte, error) {
+	type result struct {
+		line []byte
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		line, err := c.stdout.ReadBytes('\n')
+		ch <- result{line, err}
+	}()
+
+	var timeout <-chan time.Time
+	if c.timeout > 0 {
+		timer := time.NewTimer(c.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case res := <-ch:
+		if res.err != nil {
+			return nil, fmt.Errorf("failed to read response from plugin %q: %s", c.name, res.err)
+		}
+		return res.line, nil
+	case <-timeout:
+		c.failed = fmt.Errorf("plugin %q did not respond within %s, so it was stopped", c.name, c.timeout)
+		c.cmd.Process.Kill()
+		return nil, c.failed
+	}
+}
@@ -0,0 +1,234 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// fakePluginEnv is the environment variable that makes the test binary act
+// as a plugin, rather than running the tests, with the behavior named by
+// its value. The tests launch the test binary itself as their plugin.
+const fakePluginEnv = "HCLCALC_FAKE_PLUGIN"
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(fakePluginEnv); mode != "" {
+		if err := serveFake(mode); err != nil {
+			fmt.Fprintf(os.Stderr, "fake plugin: %s\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeFuncs are the functions provided by the fake plugin.
+var fakeFuncs = map[string]function.Function{
+	"repeat": function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "str",
+				Type: cty.String,
+			},
+			{
+				Name: "n",
+				Type: cty.Number,
+			},
+		},
+		Type: function.StaticReturnType(cty.List(cty.String)),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			n, _ := args[1].AsBigFloat().Int64()
+			if n < 1 {
+				return cty.DynamicVal, function.NewArgErrorf(1, "must be at least 1")
+			}
+			elems := make([]cty.Value, n)
+			for i := range elems {
+				elems[i] = args[0]
+			}
+			return cty.ListVal(elems), nil
+		},
+	}),
+	"sum": function.New(&function.Spec{
+		VarParam: &function.Parameter{
+			Name: "nums",
+			Type: cty.Number,
+		},
+		Type: function.StaticReturnType(cty.Number),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			sum := cty.Zero
+			for _, arg := range args {
+				sum = sum.Add(arg)
+			}
+			return sum, nil
+		},
+	}),
+}
+
+// serveFake implements the fake plugin. The "normal" mode serves fakeFuncs
+// using ServeIO, while the others misbehave once the first call arrives.
+func serveFake(mode string) error {
+	if mode == "normal" {
+		return ServeIO(fakeFuncs, os.Stdin, os.Stdout)
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	enc := json.NewEncoder(os.Stdout)
+	for {
+		line, err := in.ReadBytes('\n')
+		if err != nil {
+			return nil
+		}
+		var req request
+		if err := json.Unmarshal(line, &req); err != nil {
+			return err
+		}
+		resp := handle(fakeFuncs, &req)
+		resp.ID = req.ID
+		if req.Method == "call" {
+			switch mode {
+			case "mismatch":
+				resp.ID = req.ID + 1
+			case "exit":
+				os.Exit(3)
+			case "hang":
+				time.Sleep(time.Hour)
+			}
+		}
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// launchFake launches the test binary as a fake plugin in the given mode,
+// stopping it once the test is complete.
+func launchFake(t *testing.T, mode string) *Client {
+	os.Setenv(fakePluginEnv, mode)
+	defer os.Unsetenv(fakePluginEnv)
+	c, err := Launch("fake", os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c.Close()
+	})
+	return c
+}
+
+func fakeFunctions(t *testing.T, c *Client) map[string]function.Function {
+	funcs, err := c.Functions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return funcs
+}
+
+func TestClientFunctions(t *testing.T) {
+	funcs := fakeFunctions(t, launchFake(t, "normal"))
+	if len(funcs) != len(fakeFuncs) {
+		t.Fatalf("got %d functions, want %d", len(funcs), len(fakeFuncs))
+	}
+
+	repeat := funcs["repeat"]
+	params := repeat.Params()
+	if len(params) != 2 {
+		t.Fatalf("repeat has %d parameters, want 2", len(params))
+	}
+	if params[0].Name != "str" || !params[0].Type.Equals(cty.String) {
+		t.Errorf("wrong first parameter %s of type %#v", params[0].Name, params[0].Type)
+	}
+	if params[1].Name != "n" || !params[1].Type.Equals(cty.Number) {
+		t.Errorf("wrong second parameter %s of type %#v", params[1].Name, params[1].Type)
+	}
+	if repeat.VarParam() != nil {
+		t.Errorf("repeat has a variadic parameter")
+	}
+
+	varParam := funcs["sum"].VarParam()
+	if varParam == nil || varParam.Name != "nums" || !varParam.Type.Equals(cty.Number) {
+		t.Errorf("wrong variadic parameter for sum: %#v", varParam)
+	}
+}
+
+func TestClientCall(t *testing.T) {
+	funcs := fakeFunctions(t, launchFake(t, "normal"))
+
+	got, err := funcs["repeat"].Call([]cty.Value{cty.StringVal("a"), cty.NumberIntVal(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("a")})
+	if !got.RawEquals(want) {
+		t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+	}
+
+	got, err = funcs["sum"].Call([]cty.Value{cty.NumberIntVal(1), cty.NumberIntVal(2), cty.NumberIntVal(3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.RawEquals(cty.NumberIntVal(6)) {
+		t.Errorf("wrong result %#v, want 6", got)
+	}
+}
+
+func TestClientCallArgError(t *testing.T) {
+	funcs := fakeFunctions(t, launchFake(t, "normal"))
+
+	_, err := funcs["repeat"].Call([]cty.Value{cty.StringVal("a"), cty.NumberIntVal(0)})
+	argErr, ok := err.(function.ArgError)
+	if !ok {
+		t.Fatalf("got error %#v, want a function.ArgError", err)
+	}
+	if argErr.Index != 1 {
+		t.Errorf("error is for argument %d, want 1", argErr.Index)
+	}
+	if got, want := argErr.Error(), "must be at least 1"; got != want {
+		t.Errorf("wrong error message %q, want %q", got, want)
+	}
+}
+
+func TestClientIDMismatch(t *testing.T) {
+	funcs := fakeFunctions(t, launchFake(t, "mismatch"))
+
+	_, err := funcs["sum"].Call(nil)
+	if err == nil || !strings.Contains(err.Error(), "sent a response to request 3 when 2 was expected") {
+		t.Errorf("wrong error %v", err)
+	}
+}
+
+func TestClientPluginExit(t *testing.T) {
+	funcs := fakeFunctions(t, launchFake(t, "exit"))
+
+	_, err := funcs["sum"].Call(nil)
+	if err == nil || !strings.Contains(err.Error(), "failed to read response") {
+		t.Errorf("wrong error %v", err)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	c := launchFake(t, "hang")
+	funcs := fakeFunctions(t, c)
+	c.SetTimeout(100 * time.Millisecond)
+
+	_, err := funcs["sum"].Call(nil)
+	if err == nil || !strings.Contains(err.Error(), "did not respond within 100ms") {
+		t.Fatalf("wrong error %v", err)
+	}
+
+	// The plugin is stopped, so later calls fail immediately.
+	start := time.Now()
+	_, err = funcs["sum"].Call(nil)
+	if err == nil || !strings.Contains(err.Error(), "did not respond") {
+		t.Errorf("wrong error %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("second call took %s", elapsed)
+	}
+}
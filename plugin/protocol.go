@@ -0,0 +1,78 @@
+// Package plugin implements external function plugins for the calculator.
+//
+// A plugin is an executable that the calculator launches as a subprocess,
+// exchanging JSON messages with it over the plugin's stdin and stdout. Each
+// message is a single JSON object on a line of its own. The calculator
+// sends requests and the plugin replies to each with a response carrying
+// the same "id", in the order the requests were sent.
+//
+// The "functions" request asks for the signatures of the functions the
+// plugin provides:
+//
+//	{"id":1,"method":"functions"}
+//	{"id":1,"functions":{"double":{"params":[{"name":"n","type":"number"}]}}}
+//
+// Parameter types use the JSON type syntax of cty/json, such as "string"
+// or ["list","number"], with "dynamic" accepting a value of any type. A
+// function may also have a "var_param" for any further arguments.
+//
+// The "call" request calls one of those functions. Each argument and the
+// result are encoded as by cty/json with the dynamic pseudo-type, so that
+// they carry their types along with their values:
+//
+//	{"id":2,"method":"call","function":"double","args":[{"value":2,"type":"number"}]}
+//	{"id":2,"result":{"value":4,"type":"number"}}
+//
+// A call that fails produces an error instead, optionally identifying the
+// index of the argument that was invalid:
+//
+//	{"id":3,"error":{"message":"must be positive","arg":0}}
+//
+// The plugin should exit once its stdin is closed. Anything it writes to
+// stderr is passed through to the calculator's stderr.
+//
+// Plugins written in Go can use Serve to implement the protocol for a set
+// of cty functions.
+package plugin
+
+import (
+	"encoding/json"
+)
+
+// request is a message sent from the calculator to a plugin.
+type request struct {
+	ID       int               `json:"id"`
+	Method   string            `json:"method"`
+	Function string            `json:"function,omitempty"`
+	Args     []json.RawMessage `json:"args,omitempty"`
+}
+
+// response is a message sent from a plugin to the calculator in reply to
+// a request.
+type response struct {
+	ID        int                  `json:"id"`
+	Functions map[string]*funcSpec `json:"functions,omitempty"`
+	Result    json.RawMessage      `json:"result,omitempty"`
+	Error     *callError           `json:"error,omitempty"`
+}
+
+// funcSpec describes the signature of a function provided by a plugin.
+type funcSpec struct {
+	Params   []*paramSpec `json:"params"`
+	VarParam *paramSpec   `json:"var_param,omitempty"`
+}
+
+type paramSpec struct {
+	Name      string          `json:"name"`
+	Type      json.RawMessage `json:"type"`
+	AllowNull bool            `json:"allow_null,omitempty"`
+}
+
+type callError struct {
+	Message string `json:"message"`
+	Arg     *int   `json:"arg,omitempty"`
+}
+
+func (e *callError) Error() string {
+	return e.Message
+}
@@ -0,0 +1,138 @@
+// Command sample is an example calculator plugin that looks up values in a
+// local JSON data file, given with the -data option. The file must contain
+// an object whose properties are tables, each of which is an object mapping
+// keys to values. For example, given a file like this:
+//
+//	{"regions": {"eu-west-1": {"name": "Ireland", "zones": 3}}}
+//
+// the expression lookup("regions", "eu-west-1").name produces "Ireland".
+//
+// To use it, build it and then declare it in the calculator's config file:
+//
+//	plugin "sample" {
+//	  command = "/path/to/sample"
+//	  args    = ["-data", "/path/to/data.json"]
+//	}
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/apparentlymart/hclcalc/plugin"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+func main() {
+	dataFile := flag.String("data", "data.json", "JSON file containing the tables to look up")
+	flag.Parse()
+
+	data, err := loadData(*dataFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sample plugin: %s\n", err)
+		os.Exit(1)
+	}
+
+	err = plugin.Serve(map[string]function.Function{
+		"lookup":     lookupFunc(data),
+		"lookupkeys": lookupKeysFunc(data),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sample plugin: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func loadData(filename string) (map[string]map[string]cty.Value, error) {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	ty, err := ctyjson.ImpliedType(src)
+	if err != nil {
+		return nil, err
+	}
+	val, err := ctyjson.Unmarshal(src, ty)
+	if err != nil {
+		return nil, err
+	}
+	if !ty.IsObjectType() {
+		return nil, fmt.Errorf("%s must contain a JSON object", filename)
+	}
+
+	data := make(map[string]map[string]cty.Value)
+	for name := range ty.AttributeTypes() {
+		table := val.GetAttr(name)
+		if !table.Type().IsObjectType() {
+			return nil, fmt.Errorf("table %q in %s must be a JSON object", name, filename)
+		}
+		data[name] = make(map[string]cty.Value)
+		for key := range table.Type().AttributeTypes() {
+			data[name][key] = table.GetAttr(key)
+		}
+	}
+	return data, nil
+}
+
+func lookupFunc(data map[string]map[string]cty.Value) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "table",
+				Type: cty.String,
+			},
+			{
+				Name: "key",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.DynamicPseudoType),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			table, exists := data[args[0].AsString()]
+			if !exists {
+				return cty.DynamicVal, function.NewArgErrorf(0, "there is no table named %q", args[0].AsString())
+			}
+			val, exists := table[args[1].AsString()]
+			if !exists {
+				return cty.DynamicVal, function.NewArgErrorf(1, "table %q has no key %q", args[0].AsString(), args[1].AsString())
+			}
+			return val, nil
+		},
+	})
+}
+
+func lookupKeysFunc(data map[string]map[string]cty.Value) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "table",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.List(cty.String)),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			table, exists := data[args[0].AsString()]
+			if !exists {
+				return cty.DynamicVal, function.NewArgErrorf(0, "there is no table named %q", args[0].AsString())
+			}
+			if len(table) == 0 {
+				return cty.ListValEmpty(cty.String), nil
+			}
+			keys := make([]string, 0, len(table))
+			for key := range table {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			vals := make([]cty.Value, len(keys))
+			for i, key := range keys {
+				vals[i] = cty.StringVal(key)
+			}
+			return cty.ListVal(vals), nil
+		},
+	})
+}
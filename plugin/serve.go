@@ -0,0 +1,130 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Serve implements the plugin protocol over stdin and stdout for the given
+// functions, returning once stdin is closed. It is intended to be called
+// from the main function of a plugin.
+func Serve(funcs map[string]function.Function) error {
+	return ServeIO(funcs, os.Stdin, os.Stdout)
+}
+
+// ServeIO is like Serve, but uses the given reader and writer in place of
+// stdin and stdout.
+func ServeIO(funcs map[string]function.Function, r io.Reader, w io.Writer) error {
+	in := bufio.NewReader(r)
+	enc := json.NewEncoder(w)
+	for {
+		line, err := in.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(line, &req); err != nil {
+			return fmt.Errorf("invalid request: %s", err)
+		}
+		resp := handle(funcs, &req)
+		resp.ID = req.ID
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func handle(funcs map[string]function.Function, req *request) *response {
+	switch req.Method {
+	case "functions":
+		specs := make(map[string]*funcSpec, len(funcs))
+		for name, f := range funcs {
+			spec, err := encodeSpec(f)
+			if err != nil {
+				return errorResponse(fmt.Errorf("function %q: %s", name, err))
+			}
+			specs[name] = spec
+		}
+		return &response{Functions: specs}
+
+	case "call":
+		f, exists := funcs[req.Function]
+		if !exists {
+			return errorResponse(fmt.Errorf("no function is named %q", req.Function))
+		}
+		args := make([]cty.Value, len(req.Args))
+		for i, buf := range req.Args {
+			arg, err := ctyjson.Unmarshal(buf, cty.DynamicPseudoType)
+			if err != nil {
+				return errorResponse(function.NewArgError(i, err))
+			}
+			args[i] = arg
+		}
+		result, err := f.Call(args)
+		if err != nil {
+			return errorResponse(err)
+		}
+		buf, err := ctyjson.Marshal(result, cty.DynamicPseudoType)
+		if err != nil {
+			return errorResponse(fmt.Errorf("invalid result: %s", err))
+		}
+		return &response{Result: buf}
+
+	default:
+		return errorResponse(fmt.Errorf("unsupported method %q", req.Method))
+	}
+}
+
+func encodeSpec(f function.Function) (*funcSpec, error) {
+	spec := &funcSpec{
+		Params: make([]*paramSpec, 0, len(f.Params())),
+	}
+	for _, param := range f.Params() {
+		ps, err := encodeParam(param)
+		if err != nil {
+			return nil, err
+		}
+		spec.Params = append(spec.Params, ps)
+	}
+	if param := f.VarParam(); param != nil {
+		ps, err := encodeParam(*param)
+		if err != nil {
+			return nil, err
+		}
+		spec.VarParam = ps
+	}
+	return spec, nil
+}
+
+func encodeParam(param function.Parameter) (*paramSpec, error) {
+	ty, err := ctyjson.MarshalType(param.Type)
+	if err != nil {
+		return nil, fmt.Errorf("parameter %q: %s", param.Name, err)
+	}
+	return &paramSpec{
+		Name:      param.Name,
+		Type:      ty,
+		AllowNull: param.AllowNull,
+	}, nil
+}
+
+func errorResponse(err error) *response {
+	ce := &callError{
+		Message: err.Error(),
+	}
+	if argErr, ok := err.(function.ArgError); ok {
+		ce.Arg = &argErr.Index
+	}
+	return &response{Error: ce}
+}
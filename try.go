@@ -3,31 +3,129 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"flag"
 	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/apparentlymart/hclcalc/calc"
 	prompt "github.com/c-bata/go-prompt"
 	"github.com/hashicorp/hcl2/hcl"
 	"github.com/hashicorp/hcl2/hcl/hclsyntax"
 	wordwrap "github.com/mitchellh/go-wordwrap"
+	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/json"
 )
 
 func main() {
+	now := flag.String("now", "", "fix the current time returned by timestamp() to the given RFC 3339 timestamp")
+	seed := flag.Int64("seed", 0, "seed for the pseudo-random functions random, shuffle, sample and uuid")
+	baseDir := flag.String("dir", ".", "directory that the file functions may read from")
+	envNames := flag.String("env", "", "comma-separated names of environment variables that may be read with env()")
+	profile := flag.String("profile", calc.DefaultProfile, fmt.Sprintf("set of functions to make available: %s", strings.Join(calc.ProfileNames(), ", ")))
+	configFile := flag.String("config", "", "configuration file declaring plugins (default ~/.hclcalc.hcl, if present)")
+	timeout := flag.Duration("timeout", calc.DefaultLimits.Timeout, "longest time an evaluation may run for, or 0 for no limit")
+	maxElements := flag.Int("max-elements", calc.DefaultLimits.MaxElements, "largest number of elements a value may contain, or 0 for no limit")
+	maxString := flag.Int("max-string", calc.DefaultLimits.MaxStringLength, "length in bytes of the longest string a value may contain, or 0 for no limit")
+	refuseCycles := flag.Bool("refuse-cycles", false, "refuse definitions that would create a dependency cycle, rather than warning about them")
+	parallelism := flag.Int("parallelism", runtime.GOMAXPROCS(0), "largest number of independent symbols to evaluate at the same time")
+	flag.Parse()
+
 	pp := prompt.NewStandardInputParser()
 	size := pp.GetWinSize()
 
-	table := calc.NewTable()
+	opts := []calc.Option{
+		calc.WithSeed(*seed),
+		calc.WithBaseDir(*baseDir),
+		calc.WithParallelism(*parallelism),
+		calc.WithRefuseCycles(*refuseCycles),
+		calc.WithLimits(calc.Limits{
+			Timeout:         *timeout,
+			MaxElements:     *maxElements,
+			MaxStringLength: *maxString,
+		}),
+	}
+	if *now != "" {
+		fixed, err := time.Parse(time.RFC3339, *now)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -now timestamp: %s\n", err)
+			os.Exit(2)
+		}
+		opts = append(opts, calc.WithClock(calc.FixedClock(fixed)))
+	}
+	if *configFile == "" {
+		if def := defaultConfigFile(); def != "" {
+			if _, err := os.Stat(def); err == nil {
+				*configFile = def
+			}
+		}
+	}
+	if *configFile != "" {
+		cfg, diags := loadConfig(*configFile)
+		if !diags.HasErrors() {
+			clients, pluginOpts, pluginDiags := launchPlugins(cfg)
+			diags = append(diags, pluginDiags...)
+			opts = append(opts, pluginOpts...)
+			defer func() {
+				for _, client := range clients {
+					client.Close()
+				}
+			}()
+		}
+		if len(diags) != 0 {
+			for _, diag := range diags {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", diag.Summary, diag.Detail)
+			}
+			if diags.HasErrors() {
+				os.Exit(2)
+			}
+		}
+	}
+	table := calc.NewTable(opts...)
+	if err := table.SetProfile(*profile); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -profile option: %s\n", err)
+		os.Exit(2)
+	}
+	if *envNames != "" {
+		diags := table.AllowEnv(strings.Split(*envNames, ",")...)
+		if diags.HasErrors() {
+			for _, diag := range diags {
+				fmt.Fprintf(os.Stderr, "Invalid -env option: %s\n", diag.Detail)
+			}
+			os.Exit(2)
+		}
+	}
 	u := ui{
-		table: table,
-		size:  size,
+		table:    table,
+		size:     size,
+		settings: &settings{},
+	}
+	for _, path := range flag.Args() {
+		if !u.loadFile(path) {
+			os.Exit(1)
+		}
 	}
 	u.runREPL()
 }
 
 type ui struct {
-	table *calc.Table
-	size  *prompt.WinSize
+	table    *calc.Table
+	size     *prompt.WinSize
+	settings *settings
+}
+
+// settings are the options that can be changed during a session using
+// directives. ui is passed around by value, so these live behind a pointer
+// to allow directives to modify them.
+type settings struct {
+	// showBases causes whole numbers produced by expressions to be shown
+	// in hexadecimal, binary and octal notation alongside the decimal.
+	showBases bool
 }
 
 func (u ui) runREPL() {
@@ -35,6 +133,33 @@ func (u ui) runREPL() {
 	p.Run()
 }
 
+// interruptible returns a context that is cancelled if the user presses
+// Ctrl-C, so that a long-running evaluation can be abandoned without
+// exiting, along with a function to call once the evaluation is complete.
+//
+// An evaluation only notices that it was cancelled when it next calls a
+// function, which an expression like a nested for expression might not do
+// for a long time, so the first Ctrl-C also restores the default handling
+// of the signal, allowing a second Ctrl-C to exit.
+func interruptible() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	go func() {
+		select {
+		case <-sigCh:
+			signal.Reset(os.Interrupt)
+			fmt.Fprint(os.Stderr, "Cancelling the evaluation. Press Ctrl-C again to exit.\n")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sigCh)
+		cancel()
+	}
+}
+
 func (u ui) executor(inp string) {
 	src := []byte(inp)
 	toks, _ := hclsyntax.LexExpression(src, "", hcl.Pos{Line: 1, Column: 1})
@@ -63,11 +188,21 @@ func (u ui) executor(inp string) {
 }
 
 func (u ui) exprOrAssign(toks hclsyntax.Tokens, src []byte) {
-	// First we'll see if this looks like an assignment. Any expression that
-	// has an equals sign outside of brackets is potentially an assignment,
-	// although we'll do some extra validation of the left hand side once
-	// we've done this initial pass so we can give the user good feedback
-	// if it's invalid.
+	if lvalueSrc, exprSrc, ok := splitAssignment(toks, src); ok {
+		u.assign(u.table, lvalueSrc, exprSrc)
+		return
+	}
+
+	// If we fall out here then we'll try for a naked expression
+	u.expr(src)
+}
+
+// splitAssignment returns the source code either side of the equals sign if
+// the given tokens look like an assignment. Any expression that has an
+// equals sign outside of brackets is potentially an assignment, although
+// assign does some extra validation of the left hand side so we can give
+// the user good feedback if it's invalid.
+func splitAssignment(toks hclsyntax.Tokens, src []byte) (lvalueSrc, exprSrc []byte, ok bool) {
 	bracketCount := 0
 	eqPos := -1
 Tokens:
@@ -95,17 +230,22 @@ Tokens:
 			Start:    toks[eqPos].Range.End,
 			End:      toks[len(toks)-1].Range.End,
 		}
-		lvalueSrc := lvalueRange.SliceBytes(src)
-		exprSrc := exprRange.SliceBytes(src)
-		u.assign(lvalueSrc, exprSrc)
-		return
+		return lvalueRange.SliceBytes(src), exprRange.SliceBytes(src), true
 	}
+	return nil, nil, false
+}
 
-	// If we fall out here then we'll try for a naked expression
-	u.expr(src)
+// definer is where assignments made by the user are defined, which is
+// either the table itself or a batch of changes to it.
+type definer interface {
+	Define(name string, expr calc.Expression) hcl.Diagnostics
+	DefineFunc(name string, params []string, varParam bool, expr calc.Expression) hcl.Diagnostics
+	Source(name string) []byte
 }
 
-func (u ui) assign(lvalueSrc, exprSrc []byte) {
+// assign defines a symbol or function in the given definer, returning
+// true if successful. Any problems are shown to the user.
+func (u ui) assign(d definer, lvalueSrc, exprSrc []byte) bool {
 	lvalueTrav, diags := hclsyntax.ParseTraversalAbs(lvalueSrc, "", hcl.Pos{Line: 1, Column: 1})
 	if len(lvalueTrav) != 1 || diags.HasErrors() {
 		// Maybe this is a function definition
@@ -113,8 +253,7 @@ func (u ui) assign(lvalueSrc, exprSrc []byte) {
 		if !funcExprDiags.HasErrors() {
 			callExpr, ok := funcExpr.Expression.(*hclsyntax.FunctionCallExpr)
 			if ok {
-				u.defineFunc(callExpr, lvalueSrc, exprSrc)
-				return
+				return u.defineFunc(d, callExpr, lvalueSrc, exprSrc)
 			}
 		}
 
@@ -123,22 +262,33 @@ func (u ui) assign(lvalueSrc, exprSrc []byte) {
 			Summary:  "Invalid assignment target",
 			Detail:   fmt.Sprintf("Cannot assign to %s: a single identifier or a function signature is required.", bytes.TrimSpace(lvalueSrc)),
 		})
-		u.showDiags(diags)
-		return
+		u.showDiagsFrom(diags, nil, d.Source)
+		return false
 	}
 
 	sym := lvalueTrav.RootName()
 	expr, exprDiags := calc.ParseExpression(exprSrc, sym)
 	diags = append(diags, exprDiags...)
-	u.showDiags(diags)
+
+	// Diagnostics about the new definition refer to its source code even
+	// if it isn't defined, such as when it's refused.
+	source := func(name string) []byte {
+		if name == sym {
+			return exprSrc
+		}
+		return d.Source(name)
+	}
+	u.showDiagsFrom(diags, nil, source)
 	if diags.HasErrors() {
-		return
+		return false
 	}
 
-	u.table.Define(sym, expr)
+	diags = d.Define(sym, expr)
+	u.showDiagsFrom(diags, nil, source)
+	return !diags.HasErrors()
 }
 
-func (u ui) defineFunc(lvalueExpr *hclsyntax.FunctionCallExpr, lvalueSrc []byte, exprSrc []byte) {
+func (u ui) defineFunc(d definer, lvalueExpr *hclsyntax.FunctionCallExpr, lvalueSrc []byte, exprSrc []byte) bool {
 	name := lvalueExpr.Name
 
 	// We use the function call syntax for our definition syntax, but for
@@ -166,18 +316,20 @@ func (u ui) defineFunc(lvalueExpr *hclsyntax.FunctionCallExpr, lvalueSrc []byte,
 		paramNames = append(paramNames, traversal.RootName())
 	}
 	if paramDiags.HasErrors() {
-		u.showDiagsSrc(paramDiags, lvalueSrc)
-		return
+		u.showDiagsFrom(paramDiags, lvalueSrc, d.Source)
+		return false
 	}
 
 	symName := name + "()"
 	expr, exprDiags := calc.ParseExpression(exprSrc, symName)
 	if exprDiags.HasErrors() {
-		u.showDiags(exprDiags)
-		return
+		u.showDiagsFrom(exprDiags, nil, d.Source)
+		return false
 	}
 
-	u.table.DefineFunc(name, paramNames, varParam, expr)
+	diags := d.DefineFunc(name, paramNames, varParam, expr)
+	u.showDiagsFrom(diags, nil, d.Source)
+	return !diags.HasErrors()
 }
 
 func (u ui) expr(src []byte) {
@@ -187,7 +339,9 @@ func (u ui) expr(src []byte) {
 		return
 	}
 
-	val, valDiags := u.table.Eval(expr)
+	ctx, done := interruptible()
+	val, valDiags := u.table.EvalContext(ctx, expr)
+	done()
 	diags = append(diags, valDiags...)
 	u.showDiagsSrc(diags, src)
 	known := val.IsWhollyKnown()
@@ -202,18 +356,97 @@ func (u ui) expr(src []byte) {
 		return
 	}
 
+	if qty, ok := calc.QuantityString(val); ok {
+		fmt.Printf("%s\n\n", qty)
+		return
+	}
+
 	outBytes, _ := json.Marshal(val, val.Type())
+	if bases := formatIntBases(val); u.settings.showBases && bases != "" {
+		fmt.Printf("%s (%s)\n\n", outBytes, bases)
+		return
+	}
 	fmt.Printf("%s\n\n", outBytes)
 }
 
+// formatIntBases returns the given value written out in hexadecimal, binary
+// and octal notation, or the empty string if the value is not a known whole
+// number.
+func formatIntBases(val cty.Value) string {
+	if !val.IsKnown() || val.IsNull() || val.Type() != cty.Number {
+		return ""
+	}
+	bf := val.AsBigFloat()
+	if !bf.IsInt() {
+		return ""
+	}
+	num, _ := bf.Int(nil)
+	sign := ""
+	if num.Sign() < 0 {
+		sign = "-"
+		num.Neg(num)
+	}
+	return fmt.Sprintf("%s0x%s, %s0b%s, %s0o%s", sign, num.Text(16), sign, num.Text(2), sign, num.Text(8))
+}
+
 func (u ui) directive(name string, toks hclsyntax.Tokens, src []byte) {
 	switch name {
 
+	case "bases":
+		on, diags := switchArg(toks, u.settings.showBases)
+		if diags.HasErrors() {
+			u.showDiags(diags)
+			break
+		}
+		u.settings.showBases = on
+		if on {
+			fmt.Print("Whole numbers will also be shown in hexadecimal, binary and octal.\n\n")
+		} else {
+			fmt.Print("Numbers will be shown in decimal only.\n\n")
+		}
+
+	case "cache":
+		stats := u.table.CacheStats()
+		fmt.Printf("%d values cached; %d hits, %d misses, %d invalidated.\n\n", stats.Entries, stats.Hits, stats.Misses, stats.Invalidations)
+
 	case "clear":
 		fmt.Print("\x1b[2J\x1b[0;0H")
 
+	case "cycles":
+		if len(toks) == 0 {
+			if u.table.RefuseCycles() {
+				fmt.Print("Definitions that would create a dependency cycle are refused.\n\n")
+			} else {
+				fmt.Print("Definitions that would create a dependency cycle are accepted with a warning.\n\n")
+			}
+			break
+		}
+		var arg string
+		if len(toks) == 1 {
+			arg = string(toks[0].Bytes)
+		}
+		if arg != "refuse" && arg != "warn" {
+			var diags hcl.Diagnostics
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid directive argument",
+				Detail:   "This directive accepts either \"refuse\" or \"warn\", or no argument to show the current setting.",
+			})
+			u.showDiags(diags)
+			break
+		}
+		refuse := arg == "refuse"
+		u.table.SetRefuseCycles(refuse)
+		if refuse {
+			fmt.Print("Definitions that would create a dependency cycle will now be refused.\n\n")
+		} else {
+			fmt.Print("Definitions that would create a dependency cycle will now be accepted with a warning.\n\n")
+		}
+
 	case "defs":
-		entries, _ := u.table.Values()
+		ctx, done := interruptible()
+		entries, _ := u.table.ValuesContext(ctx)
+		done()
 
 		nameLen := 0
 		for _, entry := range entries {
@@ -232,8 +465,102 @@ func (u ui) directive(name string, toks hclsyntax.Tokens, src []byte) {
 			}
 		}
 
+	case "env":
+		names := u.table.EnvNames()
+		if len(names) == 0 {
+			fmt.Print("Reading environment variables is not allowed. Use the -env option to allow particular variables.\n\n")
+			break
+		}
+
+		nameLen := 0
+		for _, name := range names {
+			if len(name) > nameLen {
+				nameLen = len(name)
+			}
+		}
+		for _, name := range names {
+			val, _ := u.table.Value(name)
+			if !val.IsKnown() || val.IsNull() {
+				fmt.Printf("%*s (not set)\n", nameLen, name)
+				continue
+			}
+			fmt.Printf("%*s = %q\n", nameLen, name, val.AsString())
+		}
+		fmt.Print("\n")
+
+	case "load":
+		if len(toks) == 0 {
+			var diags hcl.Diagnostics
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid directive argument",
+				Detail:   "This directive accepts the path of a file of definitions to load.",
+			})
+			u.showDiags(diags)
+			break
+		}
+		// The path is taken from the raw source rather than the tokens,
+		// since paths are not valid expressions.
+		path := strings.TrimSpace(string(src[toks[0].Range.Start.Byte:]))
+		u.loadFile(path)
+
+	case "paste":
+		u.paste()
+
+	case "profile":
+		if len(toks) == 0 {
+			fmt.Printf("Using the %s function profile. The available profiles are %s.\n\n", u.table.Profile(), strings.Join(calc.ProfileNames(), ", "))
+			break
+		}
+		if len(toks) != 1 || toks[0].Type != hclsyntax.TokenIdent {
+			var diags hcl.Diagnostics
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid directive argument",
+				Detail:   "This directive accepts the name of a function profile, or no argument to show the current profile.",
+			})
+			u.showDiags(diags)
+			break
+		}
+		if err := u.table.SetProfile(string(toks[0].Bytes)); err != nil {
+			var diags hcl.Diagnostics
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid function profile",
+				Detail:   fmt.Sprintf("Cannot use this profile: %s.", err),
+			})
+			u.showDiags(diags)
+			break
+		}
+		fmt.Printf("Now using the %s function profile.\n\n", u.table.Profile())
+
+	case "seed":
+		if len(toks) == 0 {
+			fmt.Printf("The pseudo-random functions are using seed %d.\n\n", u.table.Seed())
+			break
+		}
+		var arg []byte
+		for _, tok := range toks {
+			arg = append(arg, tok.Bytes...)
+		}
+		seed, err := strconv.ParseInt(string(arg), 10, 64)
+		if err != nil {
+			var diags hcl.Diagnostics
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid directive argument",
+				Detail:   "This directive accepts a whole number to use as the new seed, or no argument to show the current seed.",
+			})
+			u.showDiags(diags)
+			break
+		}
+		u.table.SetSeed(seed)
+		fmt.Printf("The pseudo-random functions will now use seed %d.\n\n", seed)
+
 	case "vals":
-		entries, diags := u.table.Values()
+		ctx, done := interruptible()
+		entries, diags := u.table.ValuesContext(ctx)
+		done()
 		u.showDiags(diags)
 
 		nameLen := 0
@@ -272,11 +599,41 @@ func (u ui) directive(name string, toks hclsyntax.Tokens, src []byte) {
 	}
 }
 
+// switchArg interprets the arguments of a directive that turns a setting on
+// or off. If no argument is given then the current setting is toggled.
+func switchArg(toks hclsyntax.Tokens, current bool) (bool, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	switch {
+	case len(toks) == 0:
+		return !current, nil
+	case len(toks) == 1 && toks[0].Type == hclsyntax.TokenIdent:
+		switch string(toks[0].Bytes) {
+		case "on":
+			return true, nil
+		case "off":
+			return false, nil
+		}
+	}
+	diags = append(diags, &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Invalid directive argument",
+		Detail:   "This directive accepts either \"on\" or \"off\", or no argument to toggle the current setting.",
+	})
+	return current, diags
+}
+
 func (u ui) showDiags(diags hcl.Diagnostics) {
 	u.showDiagsSrc(diags, nil)
 }
 
 func (u ui) showDiagsSrc(diags hcl.Diagnostics, defSrc []byte) {
+	u.showDiagsFrom(diags, defSrc, u.table.Source)
+}
+
+// showDiagsFrom shows the given diagnostics, using the given function to
+// find the source code of the symbols they refer to, or defSrc for those
+// that don't refer to a symbol.
+func (u ui) showDiagsFrom(diags hcl.Diagnostics, defSrc []byte, source func(name string) []byte) {
 	if len(diags) == 0 {
 		return
 	}
@@ -297,7 +654,7 @@ func (u ui) showDiagsSrc(diags hcl.Diagnostics, defSrc []byte) {
 		if diag.Subject != nil {
 			if diag.Subject.Filename != "" {
 				srcName = diag.Subject.Filename
-				src = u.table.Source(srcName)
+				src = source(srcName)
 			} else {
 				src = defSrc
 			}